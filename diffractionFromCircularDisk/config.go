@@ -0,0 +1,671 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"project2/diffraction"
+)
+
+// Длина в метрах. Принимает числа и строки с единицами: "500nm", "7.14 mm".
+type length float64
+
+var lengthUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"nm", 1e-9}, {"pm", 1e-12}, {"um", 1e-6}, {"µm", 1e-6}, {"μm", 1e-6},
+	{"mm", 1e-3}, {"cm", 1e-2}, {"km", 1e3}, {"m", 1},
+}
+
+func parseLength(s string) (length, error) {
+	s = strings.TrimSpace(s)
+	factor := 1.0
+	for _, u := range lengthUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("неверная длина %q (ожидается число с единицей nm, um, mm, cm или m)", s)
+	}
+	return length(v * factor), nil
+}
+
+func (l length) String() string { return strconv.FormatFloat(float64(l), 'g', -1, 64) }
+
+func (l *length) Set(s string) error {
+	v, err := parseLength(s)
+	*l = v
+	return err
+}
+
+// Scan позволяет вводить длины с единицами и в интерактивном режиме
+func (l *length) Scan(state fmt.ScanState, _ rune) error {
+	token, err := state.Token(true, nil)
+	if err != nil {
+		return err
+	}
+	return l.Set(string(token))
+}
+
+func (l *length) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return l.Set(s)
+	}
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("неверная длина %s", data)
+	}
+	*l = length(v)
+	return nil
+}
+
+func (l *length) UnmarshalYAML(node *yaml.Node) error {
+	return l.Set(node.Value)
+}
+
+// Размер изображения в пикселях, записывается как "800" или "1024x768"
+type imageSize struct{ Width, Height int }
+
+func (s imageSize) String() string { return fmt.Sprintf("%dx%d", s.Width, s.Height) }
+
+func (s *imageSize) Set(v string) error {
+	w, h, found := strings.Cut(strings.ToLower(strings.TrimSpace(v)), "x")
+	if !found {
+		h = w
+	}
+	var err1, err2 error
+	s.Width, err1 = strconv.Atoi(strings.TrimSpace(w))
+	s.Height, err2 = strconv.Atoi(strings.TrimSpace(h))
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("неверный размер изображения %q (ожидается 800 или 1024x768)", v)
+	}
+	return nil
+}
+
+func (s *imageSize) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return s.Set(fmt.Sprint(v))
+}
+
+func (s *imageSize) UnmarshalYAML(node *yaml.Node) error {
+	return s.Set(node.Value)
+}
+
+// Отрезок на экране "x0,y0,x1,y1": координаты — длины от центра экрана,
+// y растёт вниз, как строки изображения
+type segment [4]length
+
+func (s segment) String() string {
+	parts := make([]string, len(s))
+	for i, v := range s {
+		parts[i] = v.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *segment) Set(v string) error {
+	parts := strings.Split(v, ",")
+	if len(parts) != len(s) {
+		return fmt.Errorf("неверный отрезок %q (ожидается x0,y0,x1,y1, например -0.2mm,0,0.2mm,0.1mm)", v)
+	}
+	for i, part := range parts {
+		if err := s[i].Set(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *segment) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		return s.Set(str)
+	}
+	var list []length
+	if err := json.Unmarshal(data, &list); err != nil || len(list) != len(s) {
+		return fmt.Errorf("неверный отрезок %s (ожидается [x0, y0, x1, y1])", data)
+	}
+	copy(s[:], list)
+	return nil
+}
+
+func (s *segment) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return s.Set(node.Value)
+	}
+	var list []length
+	if err := node.Decode(&list); err != nil || len(list) != len(s) {
+		return fmt.Errorf("неверный отрезок в строке %d (ожидается [x0, y0, x1, y1])", node.Line)
+	}
+	copy(s[:], list)
+	return nil
+}
+
+// Пути к выходным файлам
+type outputConfig struct {
+	Image          string `yaml:"image" json:"image"`
+	Plot           string `yaml:"plot" json:"plot"`
+	Uncertainty    string `yaml:"uncertainty" json:"uncertainty"`
+	Spectral       string `yaml:"spectral" json:"spectral"`
+	AccuracyPlot   string `yaml:"accuracy_plot" json:"accuracy_plot"`
+	AccuracyReport string `yaml:"accuracy_report" json:"accuracy_report"`
+
+	Field   string     `yaml:"field" json:"field"`     // префикс файлов с данными поля
+	Export  stringList `yaml:"export" json:"export"`   // форматы: csv, npy, fits, png16
+	Complex string     `yaml:"complex" json:"complex"` // амплитуда: reim, magphase или пусто
+
+	Phase          bool   `yaml:"phase" json:"phase"` // сохранять карты и профиль фазы
+	PhaseMap       string `yaml:"phase_map" json:"phase_map"`
+	DomainColoring string `yaml:"domain_coloring" json:"domain_coloring"`
+	PhasePlot      string `yaml:"phase_plot" json:"phase_plot"`
+
+	FarField     string `yaml:"far_field" json:"far_field"`
+	FarFieldPlot string `yaml:"far_field_plot" json:"far_field_plot"`
+
+	SamplesMap string `yaml:"samples_map" json:"samples_map"` // карта количества точек при адаптивной выборке
+
+	Metrics string `yaml:"metrics" json:"metrics"` // отчёт о пятне, кольцах и границе тени в JSON
+	Rings   int    `yaml:"rings" json:"rings"`     // сколько тёмных и светлых колец измерять
+}
+
+// График интенсивности: линия профиля, кривые сравнения и шкалы.
+// Формат файла графика определяется расширением: png, svg, pdf и другие,
+// которые поддерживает gonum/plot.
+type plotConfig struct {
+	Profile string  `yaml:"profile" json:"profile"` // center, line, radial
+	Cut     segment `yaml:"cut" json:"cut"`         // отрезок для profile: line
+	Points  int     `yaml:"points" json:"points"`   // отсчётов профиля; 0 — с шагом в пиксель
+	Overlay string  `yaml:"overlay" json:"overlay"` // auto, none, free, analytic, both
+	LogX    bool    `yaml:"log_x" json:"log_x"`
+	LogY    bool    `yaml:"log_y" json:"log_y"`
+}
+
+func (p plotConfig) spec() diffraction.PlotSpec {
+	return diffraction.PlotSpec{
+		Profile: diffraction.ProfileSpec{
+			Kind:   diffraction.ProfileKind(p.Profile),
+			From:   [2]float64{float64(p.Cut[0]), float64(p.Cut[1])},
+			To:     [2]float64{float64(p.Cut[2]), float64(p.Cut[3])},
+			Points: p.Points,
+		},
+		Overlay: diffraction.Overlay(p.Overlay),
+		LogX:    p.LogX,
+		LogY:    p.LogY,
+	}
+}
+
+// Расширения файлов, которые умеет сохранять gonum/plot
+var plotFormats = []string{".png", ".svg", ".pdf", ".eps", ".jpg", ".jpeg", ".tif", ".tiff"}
+
+// checkPlotFormat проверяет расширение файла графика до начала расчёта
+func checkPlotFormat(filename string) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, f := range plotFormats {
+		if ext == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("неизвестный формат графика %q (ожидается %s)", filename, strings.Join(plotFormats, ", "))
+}
+
+// Список через запятую, во флаге заменяет значение целиком
+type stringList []string
+
+func (l stringList) String() string { return strings.Join(l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// Параметры методов БПФ
+type fftConfig struct {
+	Grid    int     `yaml:"grid" json:"grid"`       // узлов по каждой оси
+	Padding float64 `yaml:"padding" json:"padding"` // запас ширины сетки относительно экрана
+}
+
+// Контрольные точки долгого расчёта
+type checkpointConfig struct {
+	Path     string `yaml:"path" json:"path"`         // пусто — не сохранять
+	Interval int    `yaml:"interval" json:"interval"` // период сохранения, секунды
+}
+
+// Адаптивная выборка: точки края добавляются в пиксель, пока ошибка
+// интенсивности не достигнет цели или количество точек — предела
+type adaptiveConfig struct {
+	Target     float64 `yaml:"target" json:"target"`           // относительная ошибка; 0 — выборка фиксированная
+	MaxSamples int     `yaml:"max_samples" json:"max_samples"` // 0 — в diffraction.DefaultAdaptiveBudget раз больше samples
+}
+
+// Распределённый расчёт: процесс либо считает плитки по запросам
+// координатора (Listen), либо раздаёт их рабочим процессам (Remotes)
+type distributedConfig struct {
+	Listen  string     `yaml:"listen" json:"listen"`   // адрес рабочего процесса, например :8081
+	Remotes stringList `yaml:"remotes" json:"remotes"` // адреса рабочих процессов, например http://host:8081
+}
+
+// HTTP-сервис расчётов: принимает параметры в JSON и отдаёт картину,
+// профиль и количество зон Френеля
+type serviceConfig struct {
+	Listen      string `yaml:"listen" json:"listen"`           // адрес сервиса, например :8080
+	Concurrency int    `yaml:"concurrency" json:"concurrency"` // одновременных расчётов
+	Cache       int    `yaml:"cache" json:"cache"`             // готовых результатов в кеше
+}
+
+// Все параметры расчёта; заполняются из файла конфигурации, флагов
+// или интерактивно
+type config struct {
+	Wavelength    length                   `yaml:"wavelength" json:"wavelength"`
+	Radius        length                   `yaml:"radius" json:"radius"`
+	Distance      length                   `yaml:"distance" json:"distance"`
+	Samples       int                      `yaml:"samples" json:"samples"`
+	Screen        length                   `yaml:"screen" json:"screen"`
+	Size          imageSize                `yaml:"size" json:"size"`
+	Seed          int64                    `yaml:"seed" json:"seed"`
+	Sampling      string                   `yaml:"sampling" json:"sampling"`
+	Kernel        string                   `yaml:"kernel" json:"kernel"`
+	Solver        string                   `yaml:"solver" json:"solver"`
+	FFT           fftConfig                `yaml:"fft" json:"fft"`
+	Benchmark     bool                     `yaml:"benchmark" json:"benchmark"`
+	Regime        string                   `yaml:"regime" json:"regime"`
+	Normalization string                   `yaml:"normalization" json:"normalization"`
+	Radial        bool                     `yaml:"radial" json:"radial"`   // быстрый путь для осесимметричных задач
+	Workers       int                      `yaml:"workers" json:"workers"` // 0 — по числу ядер
+	Checkpoint    checkpointConfig         `yaml:"checkpoint" json:"checkpoint"`
+	Distributed   distributedConfig        `yaml:"distributed" json:"distributed"`
+	Service       serviceConfig            `yaml:"service" json:"service"`
+	Adaptive      adaptiveConfig           `yaml:"adaptive" json:"adaptive"`
+	Obstacle      obstacleConfig           `yaml:"obstacle" json:"obstacle"`
+	Spectrum      diffraction.SpectrumSpec `yaml:"spectrum" json:"spectrum"`
+	Illumination  illuminationConfig       `yaml:"illumination" json:"illumination"`
+	Coherence     coherenceConfig          `yaml:"coherence" json:"coherence"`
+	Geometry      geometryConfig           `yaml:"geometry" json:"geometry"`
+	Output        outputConfig             `yaml:"output" json:"output"`
+	Plot          plotConfig               `yaml:"plot" json:"plot"`
+	Sweep         sweepConfig              `yaml:"sweep" json:"sweep"`
+}
+
+func defaultConfig() config {
+	return config{
+		Wavelength:    500e-9,
+		Radius:        100e-6,
+		Distance:      7.14e-3,
+		Samples:       10000,
+		Screen:        0.5e-3,
+		Size:          imageSize{800, 800},
+		Sampling:      string(diffraction.SamplingRandom),
+		Kernel:        string(diffraction.KernelParaxial),
+		Solver:        string(diffraction.SolverEdgeSum),
+		FFT:           fftConfig{Grid: 1024, Padding: 2},
+		Regime:        string(diffraction.RegimeAuto),
+		Normalization: string(diffraction.NormalizeMax),
+		Radial:        true,
+		Checkpoint:    checkpointConfig{Interval: 60},
+		Service:       serviceConfig{Concurrency: 2, Cache: 64},
+		Obstacle:      obstacleConfig{Kind: "disk"},
+		Spectrum:      diffraction.SpectrumSpec{Kind: "mono"},
+		Illumination:  illuminationConfig{Kind: "plane"},
+		Coherence:     coherenceConfig{Source: "point", SourceSamples: 7, BandSamples: 5},
+		Plot:          plotConfig{Profile: string(diffraction.ProfileCenter), Overlay: string(diffraction.OverlayAuto)},
+		Output: outputConfig{
+			Image:          "poisson_effect.png",
+			Plot:           "intensity_plot.png",
+			Uncertainty:    "poisson_uncertainty.png",
+			Spectral:       "poisson_spectral.png",
+			AccuracyPlot:   "accuracy_plot.png",
+			AccuracyReport: "accuracy_report.txt",
+			Field:          "poisson_field",
+			PhaseMap:       "phase_map.png",
+			DomainColoring: "domain_coloring.png",
+			PhasePlot:      "phase_profile.png",
+			FarField:       "far_field.png",
+			FarFieldPlot:   "far_field_plot.png",
+			SamplesMap:     "samples_map.png",
+			Metrics:        "poisson_metrics.json",
+			Rings:          3,
+		},
+		Sweep: sweepConfig{
+			Frames: 30,
+			Delay:  10,
+			GIF:    "poisson_sweep.gif",
+			CSV:    "poisson_sweep.csv",
+		},
+	}
+}
+
+// parseCommandLine разбирает флаги и файл конфигурации. Флаги имеют
+// приоритет над файлом. Без аргументов программа работает интерактивно.
+func parseCommandLine(args []string) (config, bool, error) {
+	cfg := defaultConfig()
+	if len(args) == 0 {
+		return cfg, true, nil
+	}
+
+	// Ошибки флагов и -h обрабатывает сам пакет flag
+	fs := flag.NewFlagSet("diffraction", flag.ExitOnError)
+	configPath := fs.String("config", "", "файл конфигурации YAML или JSON")
+	fs.Var(&cfg.Wavelength, "wavelength", "длина волны, например 500nm")
+	fs.Var(&cfg.Radius, "radius", "радиус диска или размер препятствия, например 100um")
+	fs.Var(&cfg.Distance, "distance", "расстояние до экрана, например 7.14mm")
+	fs.IntVar(&cfg.Samples, "samples", cfg.Samples, "количество точек на краю препятствия")
+	fs.Var(&cfg.Screen, "screen", "ширина экрана, например 0.5mm")
+	fs.Var(&cfg.Size, "size", "размер изображения, например 800 или 1024x768")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed генератора (0 — взять из текущего времени)")
+	fs.StringVar(&cfg.Sampling, "sampling", cfg.Sampling, "метод выборки: random, uniform, gauss, stratified")
+	fs.StringVar(&cfg.Kernel, "kernel", cfg.Kernel, "ядро распространения: paraxial, fk, rs1, rs2 (fk и rs — непараксиальные интегралы Френеля-Кирхгофа и Рэлея-Зоммерфельда для плоской волны)")
+	fs.StringVar(&cfg.Solver, "solver", cfg.Solver, "метод расчёта: edge (сумма по краю), angular или fresnel (БПФ)")
+	fs.IntVar(&cfg.FFT.Grid, "fft-grid", cfg.FFT.Grid, "количество узлов сетки БПФ по каждой оси")
+	fs.Float64Var(&cfg.FFT.Padding, "fft-padding", cfg.FFT.Padding, "ширина сетки БПФ относительно экрана и препятствия")
+	fs.BoolVar(&cfg.Benchmark, "benchmark", cfg.Benchmark, "сравнить время расчёта суммой по краю и методами БПФ")
+	fs.StringVar(&cfg.Normalization, "normalization", cfg.Normalization, "нормировка интенсивности: max (множитель зон Френеля, по самому яркому пикселю) или physical (I/I0)")
+	fs.StringVar(&cfg.Regime, "regime", cfg.Regime, "зона дифракции: auto (по числу Френеля), fresnel или fraunhofer")
+	fs.BoolVar(&cfg.Radial, "radial", cfg.Radial, "для осесимметричных задач считать радиальный профиль и интерполировать его (-radial=false — каждый пиксель)")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "количество потоков расчёта (0 — по числу ядер)")
+	fs.StringVar(&cfg.Checkpoint.Path, "checkpoint", cfg.Checkpoint.Path, "файл контрольной точки: готовые плитки сохраняются, при перезапуске расчёт продолжается")
+	fs.IntVar(&cfg.Checkpoint.Interval, "checkpoint-interval", cfg.Checkpoint.Interval, "период сохранения контрольной точки, секунды")
+	fs.Float64Var(&cfg.Adaptive.Target, "adaptive", cfg.Adaptive.Target, "адаптивная выборка: целевая относительная ошибка интенсивности, например 0.01 (0 — фиксированная)")
+	fs.IntVar(&cfg.Adaptive.MaxSamples, "adaptive-max", cfg.Adaptive.MaxSamples, "наибольшее количество точек края на пиксель (0 — 64·samples)")
+	fs.StringVar(&cfg.Distributed.Listen, "serve-worker", cfg.Distributed.Listen, "работать рабочим процессом распределённого расчёта на адресе, например :8081")
+	fs.Var(&cfg.Distributed.Remotes, "remote", "адреса рабочих процессов через запятую, например http://host1:8081,http://host2:8081")
+	fs.StringVar(&cfg.Service.Listen, "serve", cfg.Service.Listen, "работать HTTP-сервисом расчётов на адресе, например :8080")
+	fs.IntVar(&cfg.Service.Concurrency, "serve-concurrency", cfg.Service.Concurrency, "количество одновременных расчётов в сервисе")
+	fs.IntVar(&cfg.Service.Cache, "serve-cache", cfg.Service.Cache, "количество готовых результатов в кеше сервиса")
+	fs.StringVar(&cfg.Obstacle.Kind, "obstacle", cfg.Obstacle.Kind, "препятствие: disk, aperture, annulus, rect, polygon, mask (префикс ~ — дополнение)")
+	fs.Var(&cfg.Obstacle.InnerRadius, "inner-radius", "внутренний радиус кольца")
+	fs.Var(&cfg.Obstacle.Height, "rect-height", "высота прямоугольника")
+	fs.IntVar(&cfg.Obstacle.Sides, "sides", cfg.Obstacle.Sides, "количество сторон многоугольника")
+	fs.StringVar(&cfg.Obstacle.MaskPath, "mask", cfg.Obstacle.MaskPath, "PNG-маска препятствия")
+	fs.StringVar(&cfg.Spectrum.Kind, "spectrum", cfg.Spectrum.Kind, "спектр источника: mono, blackbody, led, lines")
+	fs.Float64Var(&cfg.Spectrum.Temperature, "temperature", cfg.Spectrum.Temperature, "температура чёрного тела, К")
+	fs.IntVar(&cfg.Spectrum.Count, "spectrum-count", cfg.Spectrum.Count, "количество длин волн для чёрного тела")
+	fs.StringVar(&cfg.Spectrum.TablePath, "spectrum-table", cfg.Spectrum.TablePath, "таблица спектра светодиода")
+	fs.StringVar(&cfg.Spectrum.Lines, "lines", cfg.Spectrum.Lines, "лазерные линии в нм, например 532,633:0.5")
+	fs.StringVar(&cfg.Illumination.Kind, "illumination", cfg.Illumination.Kind, "падающая волна: plane, point (точечный источник) или gaussian (гауссов пучок)")
+	fs.Var(&cfg.Illumination.SourceDistance, "source-distance", "расстояние от точечного источника до препятствия, например 0.5m")
+	fs.Var(&cfg.Illumination.Waist, "waist", "радиус перетяжки гауссова пучка, например 0.3mm")
+	fs.Var(&cfg.Illumination.WaistDistance, "waist-distance", "расстояние от перетяжки до препятствия (отрицательное — перетяжка за препятствием)")
+	fs.StringVar(&cfg.Coherence.Source, "source-shape", cfg.Coherence.Source, "источник: point (когерентный), disk или slit (протяжённый некогерентный; slit — узкая горизонтальная щель)")
+	fs.Float64Var(&cfg.Coherence.AngularSize, "source-size", cfg.Coherence.AngularSize, "угловой диаметр диска или длина узкой горизонтальной щели источника, видимые от препятствия, рад")
+	fs.IntVar(&cfg.Coherence.SourceSamples, "source-samples", cfg.Coherence.SourceSamples, "количество точек протяжённого источника по диаметру")
+	fs.Var(&cfg.Coherence.Bandwidth, "bandwidth", "ширина спектра на полувысоте вокруг длины волны, например 10nm (0 — монохроматический свет)")
+	fs.IntVar(&cfg.Coherence.BandSamples, "band-samples", cfg.Coherence.BandSamples, "количество длин волн в полосе спектра")
+	fs.Float64Var(&cfg.Geometry.TiltX, "tilt-x", cfg.Geometry.TiltX, "наклон падающей волны к оси в плоскости xz, рад")
+	fs.Float64Var(&cfg.Geometry.TiltY, "tilt-y", cfg.Geometry.TiltY, "наклон падающей волны к оси в плоскости yz, рад")
+	fs.Var(&cfg.Geometry.ShiftX, "screen-shift-x", "сдвиг центра экрана с оси по x, например 50um")
+	fs.Var(&cfg.Geometry.ShiftY, "screen-shift-y", "сдвиг центра экрана с оси по y")
+	fs.Float64Var(&cfg.Geometry.ScreenTiltX, "screen-tilt-x", cfg.Geometry.ScreenTiltX, "поворот экрана вокруг вертикальной оси, рад (край x > 0 дальше от препятствия)")
+	fs.Float64Var(&cfg.Geometry.ScreenTiltY, "screen-tilt-y", cfg.Geometry.ScreenTiltY, "поворот экрана вокруг горизонтальной оси, рад (край y > 0 дальше от препятствия)")
+	fs.StringVar(&cfg.Output.Image, "image", cfg.Output.Image, "файл изображения")
+	fs.StringVar(&cfg.Output.Plot, "plot", cfg.Output.Plot, "файл графика интенсивности (.png, .svg, .pdf)")
+	fs.StringVar(&cfg.Plot.Profile, "profile", cfg.Plot.Profile, "профиль на графике: center (центральная линия), line (отрезок -cut) или radial (среднее по окружностям вокруг центра тени)")
+	fs.Var(&cfg.Plot.Cut, "cut", "отрезок профиля x0,y0,x1,y1 от центра экрана, y вниз, например -0.2mm,0,0.2mm,0.1mm")
+	fs.IntVar(&cfg.Plot.Points, "profile-points", cfg.Plot.Points, "количество отсчётов профиля (0 — с шагом в пиксель)")
+	fs.StringVar(&cfg.Plot.Overlay, "overlay", cfg.Plot.Overlay, "кривые сравнения: auto (без препятствия в физической нормировке), none, free, analytic или both")
+	fs.BoolVar(&cfg.Plot.LogX, "log-x", cfg.Plot.LogX, "логарифмическая шкала радиуса (только -profile radial)")
+	fs.BoolVar(&cfg.Plot.LogY, "log-y", cfg.Plot.LogY, "логарифмическая шкала интенсивности")
+	fs.StringVar(&cfg.Output.Uncertainty, "uncertainty", cfg.Output.Uncertainty, "файл карты погрешности")
+	fs.StringVar(&cfg.Output.Spectral, "spectral", cfg.Output.Spectral, "файл цветного изображения")
+	fs.StringVar(&cfg.Output.AccuracyPlot, "accuracy-plot", cfg.Output.AccuracyPlot, "файл графика сравнения с точным решением")
+	fs.StringVar(&cfg.Output.AccuracyReport, "accuracy-report", cfg.Output.AccuracyReport, "файл отчёта о точности")
+	fs.StringVar(&cfg.Output.Field, "field", cfg.Output.Field, "префикс файлов с данными поля")
+	fs.Var(&cfg.Output.Export, "export", "форматы данных поля через запятую: csv, npy, fits, png16")
+	fs.StringVar(&cfg.Output.Complex, "complex", cfg.Output.Complex, "экспорт амплитуды: reim или magphase")
+	fs.BoolVar(&cfg.Output.Phase, "phase", cfg.Output.Phase, "сохранить карту фазы, доменную раскраску и профиль фазы")
+	fs.StringVar(&cfg.Output.PhaseMap, "phase-map", cfg.Output.PhaseMap, "файл карты фазы")
+	fs.StringVar(&cfg.Output.DomainColoring, "domain-coloring", cfg.Output.DomainColoring, "файл доменной раскраски")
+	fs.StringVar(&cfg.Output.PhasePlot, "phase-plot", cfg.Output.PhasePlot, "файл графика фазы вдоль центральной линии")
+	fs.StringVar(&cfg.Output.FarField, "far-field", cfg.Output.FarField, "файл картины дальней зоны")
+	fs.StringVar(&cfg.Output.FarFieldPlot, "far-field-plot", cfg.Output.FarFieldPlot, "файл графика дальней зоны")
+	fs.StringVar(&cfg.Output.SamplesMap, "samples-map", cfg.Output.SamplesMap, "файл карты количества точек при адаптивной выборке")
+	fs.StringVar(&cfg.Output.Metrics, "metrics", cfg.Output.Metrics, "файл отчёта JSON о пятне Пуассона, кольцах и границе тени")
+	fs.IntVar(&cfg.Output.Rings, "rings", cfg.Output.Rings, "количество тёмных и светлых колец в отчёте")
+	fs.Var(&cfg.Sweep.Params, "sweep", "развёртка параметров, например distance=5mm:20mm,wavelength=450nm:650nm")
+	fs.IntVar(&cfg.Sweep.Frames, "frames", cfg.Sweep.Frames, "количество кадров развёртки")
+	fs.IntVar(&cfg.Sweep.Delay, "frame-delay", cfg.Sweep.Delay, "пауза между кадрами анимации, сотые доли секунды")
+	fs.StringVar(&cfg.Sweep.GIF, "sweep-gif", cfg.Sweep.GIF, "файл анимации развёртки")
+	fs.StringVar(&cfg.Sweep.CSV, "sweep-csv", cfg.Sweep.CSV, "таблица кадров развёртки")
+
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		// Разбор флагов останавливается на первом позиционном аргументе,
+		// поэтому все флаги после него тоже были бы пропущены
+		return cfg, false, fmt.Errorf("лишние аргументы командной строки: %s (параметры задаются флагами, список выводит -h)", strings.Join(fs.Args(), " "))
+	}
+	if *configPath != "" {
+		if err := loadConfigFile(*configPath, &cfg); err != nil {
+			return cfg, false, err
+		}
+		// Повторный разбор, чтобы явно заданные флаги перекрыли файл
+		fs.Parse(args)
+	}
+	return cfg, false, nil
+}
+
+// loadConfigFile читает YAML или JSON (по расширению) поверх текущих значений
+func loadConfigFile(filename string, cfg *config) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(cfg)
+	} else {
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		err = dec.Decode(cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка в файле конфигурации %s: %w", filename, err)
+	}
+	return nil
+}
+
+// promptConfig запрашивает основные параметры опыта. Остальные
+// параметры задаются только флагами и файлом конфигурации.
+func promptConfig(cfg *config) {
+	fmt.Print("Введите длину волны (в метрах или с единицами, например 500e-9 или 500nm): ")
+	fmt.Scan(&cfg.Wavelength)
+	fmt.Print("Введите радиус диска или размер препятствия (например 100e-6): ")
+	fmt.Scan(&cfg.Radius)
+	fmt.Print("Введите расстояние до экрана (например 7.14e-3): ")
+	fmt.Scan(&cfg.Distance)
+	fmt.Print("Введите количество точек на краю препятствия (например 10000): ")
+	fmt.Scan(&cfg.Samples)
+	fmt.Print("Введите ширину экрана (например 0.5e-3): ")
+	fmt.Scan(&cfg.Screen)
+}
+
+// Описание препятствия в файле конфигурации: размеры — длины с единицами
+type obstacleConfig struct {
+	Kind        string `yaml:"kind" json:"kind"`                 // disk, aperture, annulus, rect, polygon, mask
+	Complement  bool   `yaml:"complement" json:"complement"`     // дополнение по Бабине
+	InnerRadius length `yaml:"inner_radius" json:"inner_radius"` // внутренний радиус кольца
+	Height      length `yaml:"height" json:"height"`             // высота прямоугольника
+	Sides       int    `yaml:"sides" json:"sides"`               // число сторон многоугольника
+	MaskPath    string `yaml:"mask" json:"mask"`                 // путь к PNG-маске
+}
+
+func (o obstacleConfig) spec() diffraction.ObstacleSpec {
+	return diffraction.ObstacleSpec{
+		Kind:        o.Kind,
+		Complement:  o.Complement,
+		InnerRadius: float64(o.InnerRadius),
+		Height:      float64(o.Height),
+		Sides:       o.Sides,
+		MaskPath:    o.MaskPath,
+	}
+}
+
+// Падающая волна в файле конфигурации: размеры — длины с единицами
+type illuminationConfig struct {
+	Kind           string `yaml:"kind" json:"kind"`                       // plane, point, gaussian
+	SourceDistance length `yaml:"source_distance" json:"source_distance"` // от точечного источника до препятствия
+	Waist          length `yaml:"waist" json:"waist"`                     // радиус перетяжки гауссова пучка
+	WaistDistance  length `yaml:"waist_distance" json:"waist_distance"`   // от перетяжки до препятствия
+}
+
+func (i illuminationConfig) spec() diffraction.IlluminationSpec {
+	return diffraction.IlluminationSpec{
+		Kind:           i.Kind,
+		SourceDistance: float64(i.SourceDistance),
+		Waist:          float64(i.Waist),
+		WaistDistance:  float64(i.WaistDistance),
+	}
+}
+
+// Когерентность освещения в файле конфигурации: ширина спектра — длина с единицами
+type coherenceConfig struct {
+	Source        string  `yaml:"source" json:"source"`                 // point, disk, slit
+	AngularSize   float64 `yaml:"angular_size" json:"angular_size"`     // угловой диаметр диска или длина щели вдоль x, рад
+	SourceSamples int     `yaml:"source_samples" json:"source_samples"` // точек источника по диаметру
+	Bandwidth     length  `yaml:"bandwidth" json:"bandwidth"`           // ширина спектра на полувысоте
+	BandSamples   int     `yaml:"band_samples" json:"band_samples"`     // длин волн в полосе
+}
+
+func (c coherenceConfig) spec() diffraction.CoherenceSpec {
+	return diffraction.CoherenceSpec{
+		Source:        c.Source,
+		AngularSize:   c.AngularSize,
+		SourceSamples: c.SourceSamples,
+		Bandwidth:     float64(c.Bandwidth),
+		BandSamples:   c.BandSamples,
+	}
+}
+
+// Юстировка в файле конфигурации: углы в радианах, сдвиги — длины с единицами
+type geometryConfig struct {
+	TiltX       float64 `yaml:"tilt_x" json:"tilt_x"`               // наклон падающей волны в плоскости xz
+	TiltY       float64 `yaml:"tilt_y" json:"tilt_y"`               // наклон падающей волны в плоскости yz
+	ShiftX      length  `yaml:"shift_x" json:"shift_x"`             // сдвиг центра экрана по x
+	ShiftY      length  `yaml:"shift_y" json:"shift_y"`             // сдвиг центра экрана по y
+	ScreenTiltX float64 `yaml:"screen_tilt_x" json:"screen_tilt_x"` // поворот экрана вокруг вертикальной оси
+	ScreenTiltY float64 `yaml:"screen_tilt_y" json:"screen_tilt_y"` // поворот экрана вокруг горизонтальной оси
+}
+
+func (g geometryConfig) spec() diffraction.GeometrySpec {
+	return diffraction.GeometrySpec{
+		TiltX:       g.TiltX,
+		TiltY:       g.TiltY,
+		ShiftX:      float64(g.ShiftX),
+		ShiftY:      float64(g.ShiftY),
+		ScreenTiltX: g.ScreenTiltX,
+		ScreenTiltY: g.ScreenTiltY,
+	}
+}
+
+// simulationConfig переводит параметры в настройки пакета diffraction;
+// сообщения расчёта выводятся в stdout
+func (cfg *config) simulationConfig() diffraction.Config {
+	return diffraction.Config{
+		Wavelength:         float64(cfg.Wavelength),
+		Radius:             float64(cfg.Radius),
+		Distance:           float64(cfg.Distance),
+		ScreenWidth:        float64(cfg.Screen),
+		Width:              cfg.Size.Width,
+		Height:             cfg.Size.Height,
+		Samples:            cfg.Samples,
+		Sampling:           diffraction.SamplingMethod(cfg.Sampling),
+		Seed:               cfg.Seed,
+		Kernel:             diffraction.Kernel(cfg.Kernel),
+		Obstacle:           cfg.Obstacle.spec(),
+		Spectrum:           cfg.Spectrum,
+		Illumination:       cfg.Illumination.spec(),
+		Coherence:          cfg.Coherence.spec(),
+		Geometry:           cfg.Geometry.spec(),
+		Solver:             diffraction.SolverMethod(cfg.Solver),
+		FFTGrid:            cfg.FFT.Grid,
+		FFTPadding:         cfg.FFT.Padding,
+		Regime:             diffraction.Regime(cfg.Regime),
+		Radial:             cfg.Radial,
+		Workers:            cfg.Workers,
+		Adaptive:           cfg.Adaptive.Target,
+		AdaptiveMax:        cfg.Adaptive.MaxSamples,
+		Normalization:      diffraction.Normalization(cfg.Normalization),
+		Checkpoint:         cfg.Checkpoint.Path,
+		CheckpointInterval: time.Duration(cfg.Checkpoint.Interval) * time.Second,
+		Remotes:            cfg.Distributed.Remotes,
+		Log:                os.Stdout,
+	}
+}
+
+// validate проверяет, что параметры физически осмысленны и совместимы
+func (cfg *config) validate() error {
+	if cfg.Checkpoint.Path != "" && cfg.Checkpoint.Interval < 1 {
+		return fmt.Errorf("период сохранения контрольной точки должен быть положительным, получено %d", cfg.Checkpoint.Interval)
+	}
+	sim := cfg.simulationConfig()
+	if err := sim.Validate(); err != nil {
+		return err
+	}
+	if _, err := diffraction.ParseObstacleKind(cfg.Obstacle.Kind); err != nil {
+		return err
+	}
+	if cfg.Distributed.Listen != "" && len(cfg.Distributed.Remotes) > 0 {
+		return fmt.Errorf("процесс не может быть одновременно рабочим и координатором")
+	}
+	if sim.Regime == diffraction.RegimeFraunhofer && len(cfg.Sweep.Params) > 0 {
+		return fmt.Errorf("развёртка поддерживается только в ближней зоне")
+	}
+	if err := diffraction.ValidateExport(cfg.Output.Export, cfg.Output.Complex); err != nil {
+		return err
+	}
+	if !sim.Coherence.Coherent() && (cfg.Output.Phase || cfg.Output.Complex != "") {
+		return fmt.Errorf("у частично когерентного поля нет фазы: -phase и -complex недоступны")
+	}
+	if cfg.Output.Rings < 0 {
+		return fmt.Errorf("количество колец не может быть отрицательным, получено %d", cfg.Output.Rings)
+	}
+	if cfg.Plot.Profile == string(diffraction.ProfileLine) && cfg.Plot.Cut == (segment{}) {
+		return fmt.Errorf("для профиля вдоль отрезка задайте его концы флагом -cut")
+	}
+	if err := cfg.Plot.spec().Validate(); err != nil {
+		return err
+	}
+	for _, path := range []string{cfg.Output.Plot, cfg.Output.AccuracyPlot, cfg.Output.PhasePlot, cfg.Output.FarFieldPlot} {
+		if err := checkPlotFormat(path); err != nil {
+			return err
+		}
+	}
+	return cfg.Sweep.validate()
+}
+
+// createOutputDirs создаёт каталоги для выходных файлов
+func (cfg *config) createOutputDirs() error {
+	paths := []string{
+		cfg.Output.Image, cfg.Output.Plot, cfg.Output.Uncertainty, cfg.Output.Spectral,
+		cfg.Output.AccuracyPlot, cfg.Output.AccuracyReport, cfg.Output.Field,
+		cfg.Output.PhaseMap, cfg.Output.DomainColoring, cfg.Output.PhasePlot,
+		cfg.Output.FarField, cfg.Output.FarFieldPlot, cfg.Output.SamplesMap, cfg.Output.Metrics, cfg.Checkpoint.Path, cfg.Sweep.GIF, cfg.Sweep.CSV,
+	}
+	for _, path := range paths {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// closeLength сравнивает длины с точностью до округления при переводе единиц
+func closeLength(a, b length) bool {
+	return math.Abs(float64(a-b)) <= 1e-12*math.Abs(float64(b))
+}
+
+func TestParseLength(t *testing.T) {
+	cases := []struct {
+		in   string
+		want length
+	}{
+		{"500nm", 500e-9},
+		{"7.14 mm", 7.14e-3},
+		{" 0.5mm ", 0.5e-3},
+		{"100um", 100e-6},
+		{"100µm", 100e-6},
+		{"100μm", 100e-6},
+		{"2cm", 0.02},
+		{"1.5m", 1.5},
+		{"1km", 1000},
+		{"3pm", 3e-12},
+		{"0.25", 0.25},
+		{"1e-3", 1e-3},
+		{"-5mm", -5e-3},
+	}
+	for _, tc := range cases {
+		got, err := parseLength(tc.in)
+		if err != nil {
+			t.Errorf("parseLength(%q): неожиданная ошибка %v", tc.in, err)
+			continue
+		}
+		if !closeLength(got, tc.want) {
+			t.Errorf("parseLength(%q) = %g, ожидается %g", tc.in, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "mm", "five mm", "5 ft", "5mm2", "1,5mm"} {
+		if _, err := parseLength(bad); err == nil || !strings.Contains(err.Error(), "неверная длина") {
+			t.Errorf("parseLength(%q): ожидалась ошибка о неверной длине, получено %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package diffraction
+
+import (
+	"image"
+	"math"
+)
+
+// Во сколько раз больше точек края берётся на следующем уровне адаптивной выборки
+const adaptiveGrowth = 2
+
+// levelSizes возвращает количество точек, накопленное к каждому уровню
+// адаптивной выборки: первый — Samples, каждый следующий в adaptiveGrowth
+// раз больше, последний — AdaptiveMax. Без адаптивной выборки уровень один.
+func (s *Simulation) levelSizes() []int {
+	sizes := []int{s.Samples}
+	if s.Adaptive == 0 {
+		return sizes
+	}
+	for n := s.Samples; n < s.AdaptiveMax; {
+		n = min(n*adaptiveGrowth, s.AdaptiveMax)
+		sizes = append(sizes, n)
+	}
+	return sizes
+}
+
+// sampleLevels строит приращения выборки края: первое — точки расчёта,
+// следующие — независимые наборы (у каждого своя последовательность
+// streamSeed), доводящие количество точек до очередного уровня. Суммы по
+// приращениям накапливаются, поэтому пиксель, остановившийся на уровне n,
+// обходится в n точек.
+func (s *Simulation) sampleLevels() [][]Point {
+	levels := [][]Point{s.points}
+	sizes := s.levelSizes()
+	for i := 1; i < len(sizes); i++ {
+		levels = append(levels, generateEdgePoints(s.obstacle, sizes[i]-sizes[i-1], s.Sampling, streamSeed(s.Seed, int64(i)), s.Workers))
+	}
+	return levels
+}
+
+// adaptiveAmplitude добавляет приращения выборки по очереди и
+// останавливается, когда стандартная ошибка интенсивности опускается до
+// Adaptive от самой интенсивности. В тёмных кольцах относительная
+// ошибка не сходится, поэтому интенсивность ограничена снизу долей
+// relativeErrorThreshold от интенсивности падающей волны. Возвращает
+// амплитуду, ошибку и количество использованных точек.
+func (s *Simulation) adaptiveAmplitude(levels [][]Point, x, y float64) (float64, float64, float64, int) {
+	f := s.fresnelFactorAt(s.Wavelength)
+	floor := relativeErrorThreshold * f * f
+
+	var sum edgeSum
+	var re, im, se float64
+	for _, points := range levels {
+		sum.add(s, points, x, y, s.Wavelength)
+		re, im, se = sum.amplitude(s, s.Wavelength)
+		if se <= s.Adaptive*math.Max(re*re+im*im, floor) {
+			break
+		}
+	}
+	return re, im, se, sum.n
+}
+
+// SamplesImage рисует карту количества точек края на пиксель
+// в логарифмической шкале от Samples до AdaptiveMax
+func (s *Simulation) SamplesImage(field *Field) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	span := math.Log(float64(s.AdaptiveMax) / float64(s.Samples))
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			v := 0.0
+			if n := field.SamplesUsed[y][x]; n > 0 && span > 0 {
+				v = math.Log(float64(n)/float64(s.Samples)) / span
+			}
+			img.Set(x, y, heatColor(v))
+		}
+	}
+	return img
+}
+
+// PrintSamplesSummary сравнивает затраты адаптивной выборки с фиксированной
+// выборкой той же наибольшей точности
+func (s *Simulation) PrintSamplesSummary(field *Field) {
+	var total float64
+	count, atBudget := 0, 0
+	for y := range field.SamplesUsed {
+		for x, n := range field.SamplesUsed[y] {
+			if field.Opaque[y][x] {
+				continue
+			}
+			total += float64(n)
+			count++
+			if n >= s.AdaptiveMax {
+				atBudget++
+			}
+		}
+	}
+	if count == 0 {
+		return
+	}
+	mean := total / float64(count)
+	s.logf("Адаптивная выборка: в среднем %.0f точек края на пиксель, %.1f%% пикселей достигли предела %d точек\n",
+		mean, 100*float64(atBudget)/float64(count), s.AdaptiveMax)
+	s.logf("Объём вычислений — %.1f%% от фиксированной выборки по %d точек\n", 100*mean/float64(s.AdaptiveMax), s.AdaptiveMax)
+}
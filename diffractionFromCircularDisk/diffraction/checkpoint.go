@@ -0,0 +1,213 @@
+package diffraction
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"time"
+)
+
+// Параметры, от которых зависит результат расчёта. Продолжить расчёт
+// из контрольной точки можно, только если все они совпадают; они же
+// передаются рабочим процессам при распределённом расчёте.
+type renderParams struct {
+	Width, Height int
+	Wavelength    float64
+	Radius        float64
+	Distance      float64
+	Screen        float64
+	Samples       int
+	Sampling      string
+	Kernel        string
+	Seed          int64
+	Adaptive      float64 // целевая относительная ошибка адаптивной выборки
+	MaxSamples    int
+	Normalization string
+	Obstacle      ObstacleSpec
+	Illumination  IlluminationSpec
+	Geometry      GeometrySpec
+	TileSize      int
+}
+
+// Сохранённая плитка
+type checkpointTile struct {
+	Index int
+	Data  tileResult
+}
+
+// Содержимое файла контрольной точки
+type checkpointData struct {
+	Params renderParams
+	Tiles  []checkpointTile
+}
+
+// Контрольная точка текущего расчёта
+type checkpointState struct {
+	path     string
+	params   renderParams
+	interval time.Duration
+	restored []checkpointTile
+	log      func(format string, args ...any)
+}
+
+// renderParams собирает параметры расчёта
+func (s *Simulation) renderParams() renderParams {
+	return renderParams{
+		Width:         s.Width,
+		Height:        s.Height,
+		Wavelength:    s.Wavelength,
+		Radius:        s.Radius,
+		Distance:      s.Distance,
+		Screen:        s.ScreenWidth,
+		Samples:       s.Samples,
+		Sampling:      string(s.Sampling),
+		Kernel:        string(s.Kernel),
+		Seed:          s.Seed,
+		Adaptive:      s.Adaptive,
+		MaxSamples:    s.AdaptiveMax,
+		Normalization: string(s.Normalization),
+		Obstacle:      s.Obstacle,
+		Illumination:  s.Illumination.canonical(),
+		Geometry:      s.Geometry,
+		TileSize:      tileSize,
+	}
+}
+
+// config восстанавливает по параметрам задания настройки расчёта суммой по краю
+func (p renderParams) config() Config {
+	c := DefaultConfig()
+	c.Width, c.Height = p.Width, p.Height
+	c.Wavelength, c.Radius, c.Distance, c.ScreenWidth = p.Wavelength, p.Radius, p.Distance, p.Screen
+	c.Samples, c.Sampling, c.Kernel, c.Seed = p.Samples, SamplingMethod(p.Sampling), Kernel(p.Kernel), p.Seed
+	c.Adaptive, c.AdaptiveMax = p.Adaptive, p.MaxSamples
+	c.Normalization = Normalization(p.Normalization)
+	c.Obstacle = p.Obstacle
+	c.Illumination = p.Illumination
+	c.Geometry = p.Geometry
+	c.Radial = false
+	return c
+}
+
+// openCheckpoint читает контрольную точку, если файл существует, и проверяет,
+// что она сделана с теми же параметрами. Если seed не задан явно, берётся
+// seed из контрольной точки — иначе продолжить расчёт было бы невозможно.
+func (s *Simulation) openCheckpoint(explicitSeed bool) (*checkpointState, error) {
+	path, params, interval := s.Checkpoint, s.renderParams(), s.CheckpointInterval
+	state := &checkpointState{path: path, params: params, interval: interval, log: s.logf}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.logf("Контрольные точки будут сохраняться в %s каждые %v\n", path, interval)
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var data checkpointData
+	if err := gob.NewDecoder(f).Decode(&data); err != nil {
+		return nil, fmt.Errorf("не удалось прочитать контрольную точку %s: %w", path, err)
+	}
+	if !explicitSeed {
+		params.Seed = data.Params.Seed
+	}
+	if data.Params != params {
+		return nil, fmt.Errorf("контрольная точка %s сделана с другими параметрами:\n  в файле: %+v\n  сейчас:  %+v\nверните параметры или удалите файл", path, data.Params, params)
+	}
+
+	tiles := makeTiles(params.Width, params.Height, params.TileSize)
+	for _, ct := range data.Tiles {
+		n := len(ct.Data.Intensity)
+		if ct.Index < 0 || ct.Index >= len(tiles) || n != tiles[ct.Index].pixels() ||
+			len(ct.Data.StdErr) != n || len(ct.Data.Re) != n || len(ct.Data.Im) != n || len(ct.Data.Samples) != n {
+			return nil, fmt.Errorf("контрольная точка %s повреждена: плитка %d", path, ct.Index)
+		}
+	}
+
+	state.params = params
+	state.restored = data.Tiles
+	s.logf("Продолжение расчёта из %s: готово %d плиток, seed: %d\n", path, len(data.Tiles), params.Seed)
+	return state, nil
+}
+
+// restore переносит плитки из контрольной точки в поле и отмечает их готовыми.
+// Плитки проверены при открытии контрольной точки. Возвращает максимальную
+// интенсивность среди восстановленных пикселей.
+func (c *checkpointState) restore(set *tileSet, field *Field) float64 {
+	var maxI float64
+	for _, ct := range c.restored {
+		maxI = math.Max(maxI, field.storeTile(set.tiles[ct.Index], ct.Data))
+		set.done[ct.Index] = true
+	}
+	c.restored = nil
+	return maxI
+}
+
+// save записывает готовые плитки во временный файл и переименовывает его,
+// чтобы сбой во время записи не испортил предыдущую контрольную точку
+func (c *checkpointState) save(set *tileSet, field *Field) (int, error) {
+	data := checkpointData{Params: c.params}
+	for _, idx := range set.completed() {
+		data.Tiles = append(data.Tiles, checkpointTile{Index: idx, Data: field.loadTile(set.tiles[idx])})
+	}
+
+	tmp := c.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if err := gob.NewEncoder(f).Encode(&data); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return len(data.Tiles), os.Rename(tmp, c.path)
+}
+
+// autosave периодически сохраняет контрольную точку до вызова возвращённой функции
+func (c *checkpointState) autosave(set *tileSet, field *Field) func() {
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := c.save(set, field); err != nil {
+					c.log("\nНе удалось сохранить контрольную точку: %v\n", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-finished
+	}
+}
+
+// finish сохраняет контрольную точку, если расчёт прерван, и удаляет её,
+// если расчёт завершён
+func (c *checkpointState) finish(set *tileSet, field *Field, interrupted bool) {
+	if !interrupted {
+		if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			c.log("Не удалось удалить контрольную точку: %v\n", err)
+		}
+		return
+	}
+	n, err := c.save(set, field)
+	if err != nil {
+		c.log("Не удалось сохранить контрольную точку: %v\n", err)
+		return
+	}
+	c.log("Контрольная точка сохранена в %s: готово %d из %d плиток\n", c.path, n, len(set.tiles))
+}
@@ -0,0 +1,111 @@
+package diffraction
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCheckpoint сохраняет контрольную точку расчёта sim, в которой готова
+// только первая плитка со значениями r
+func writeCheckpoint(t *testing.T, sim *Simulation, path string, r tileResult) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data := checkpointData{Params: sim.renderParams(), Tiles: []checkpointTile{{Index: 0, Data: r}}}
+	if err := gob.NewEncoder(f).Encode(&data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Расчёт продолжается из контрольной точки, если параметры совпадают,
+// и отказывается от неё, если они изменились
+func TestCheckpointResume(t *testing.T) {
+	base := []Option{WithSize(64, 48), func(c *Config) { c.Radial = false }}
+	ctx := context.Background()
+	want := testSimulation(t, base...).Field(ctx)
+
+	// Готовая плитка помечена удвоенной интенсивностью: так видно,
+	// что она взята из файла, а не посчитана заново. Пятно Пуассона
+	// в тени дорисовывается после плиток и не помечается.
+	first := makeTiles(64, 48, tileSize)[0]
+	saved := want.loadTile(first)
+	for i := range saved.Intensity {
+		saved.Intensity[i] *= 2
+	}
+
+	cases := []struct {
+		name   string
+		modify Option
+		want   string // ошибка открытия; пусто — расчёт продолжается
+	}{
+		{"те же параметры", func(c *Config) {}, ""},
+		{"seed из файла", WithSeed(0), ""},
+		{"другой радиус", WithRadius(120e-6), "другими параметрами"},
+		{"другое количество точек", WithSamples(3000, SamplingRandom), "другими параметрами"},
+		{"другое препятствие", WithObstacle(ObstacleSpec{Kind: "polygon", Sides: 6}), "другими параметрами"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "field.checkpoint")
+			writeCheckpoint(t, testSimulation(t, base...), path, saved)
+
+			opts := append([]Option{WithSamples(2000, SamplingRandom), WithSeed(1), WithCheckpoint(path, time.Hour)}, base...)
+			sim, err := New(append(opts, tc.modify)...)
+			if tc.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.want) {
+					t.Fatalf("ошибка %v, ожидалась ошибка с %q", err, tc.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sim.Seed != 1 {
+				t.Errorf("seed %d, ожидается seed из контрольной точки 1", sim.Seed)
+			}
+
+			field := sim.Field(ctx)
+			for y := range want.Intensity {
+				for x := range want.Intensity[y] {
+					expected := want.Intensity[y][x]
+					if x < first.X1 && y < first.Y1 && !want.Opaque[y][x] {
+						expected *= 2
+					}
+					if got := field.Intensity[y][x]; got != expected {
+						t.Fatalf("пиксель (%d, %d): %g, ожидается %g", x, y, got, expected)
+					}
+				}
+			}
+			if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("контрольная точка законченного расчёта не удалена: %v", err)
+			}
+		})
+	}
+}
+
+// Прерванный расчёт сохраняет контрольную точку, которую можно продолжить
+func TestCheckpointSavedOnCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "field.checkpoint")
+	opts := []Option{WithSize(64, 48), func(c *Config) { c.Radial = false }, WithCheckpoint(path, time.Hour)}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if field := testSimulation(t, opts...).Field(ctx); !field.Partial {
+		t.Fatalf("отменённый расчёт не отмечен как неполный")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("контрольная точка не сохранена: %v", err)
+	}
+	if field := testSimulation(t, opts...).Field(context.Background()); field.Partial {
+		t.Errorf("продолженный расчёт не закончен")
+	}
+}
@@ -0,0 +1,272 @@
+package diffraction
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// CoherenceSpec — пространственная и временная когерентность освещения.
+//
+// Протяжённый источник излучает некогерентно. Это диск заданного углового
+// диаметра или узкая горизонтальная щель заданной угловой длины, видимые
+// от препятствия; ширина щели считается пренебрежимо малой, то есть щель —
+// светящийся отрезок вдоль оси x. Каждая точка источника даёт ту же
+// волну, наклонённую на угол θ, а в параксиальном приближении наклон лишь
+// сдвигает картину на экране на z·θ. Конечная ширина спектра
+// (гауссов контур с шириной Bandwidth на полувысоте вокруг Wavelength)
+// добавляет некогерентную сумму по длинам волн. Интенсивности независимых
+// когерентных вкладов складываются с весами.
+type CoherenceSpec struct {
+	Source        string  `json:"source"`                   // point, disk, slit
+	AngularSize   float64 `json:"angular_size,omitempty"`   // угловой диаметр диска или длина щели вдоль x, рад
+	SourceSamples int     `json:"source_samples,omitempty"` // точек источника по диаметру (длине щели)
+	Bandwidth     float64 `json:"bandwidth,omitempty"`      // ширина спектра на полувысоте, м; 0 — монохроматический свет
+	BandSamples   int     `json:"band_samples,omitempty"`   // длин волн в полосе
+}
+
+func (spec CoherenceSpec) validate() error {
+	switch spec.Source {
+	case "", "point":
+	case "disk", "slit":
+		if math.IsNaN(spec.AngularSize) || math.IsInf(spec.AngularSize, 0) || spec.AngularSize <= 0 {
+			return fmt.Errorf("угловой размер источника должен быть положительным, получено %v", spec.AngularSize)
+		}
+		if spec.SourceSamples < 1 {
+			return fmt.Errorf("количество точек источника должно быть положительным, получено %d", spec.SourceSamples)
+		}
+	default:
+		return fmt.Errorf("неизвестный источник %q (ожидается point, disk или slit)", spec.Source)
+	}
+	if math.IsNaN(spec.Bandwidth) || math.IsInf(spec.Bandwidth, 0) || spec.Bandwidth < 0 {
+		return fmt.Errorf("ширина спектра не может быть отрицательной, получено %v", spec.Bandwidth)
+	}
+	if spec.Bandwidth > 0 && spec.BandSamples < 1 {
+		return fmt.Errorf("количество длин волн в полосе должно быть положительным, получено %d", spec.BandSamples)
+	}
+	return nil
+}
+
+// extended сообщает, задан ли протяжённый источник
+func (spec CoherenceSpec) extended() bool { return spec.Source == "disk" || spec.Source == "slit" }
+
+// Coherent сообщает, что освещение полностью когерентно: точечный
+// монохроматический источник, у поля есть комплексная амплитуда
+func (spec CoherenceSpec) Coherent() bool { return !spec.extended() && spec.Bandwidth == 0 }
+
+// sourceAngles размещает точки источника в узлах квадратной сетки внутри
+// диска или на равных промежутках вдоль щели. Яркость источника
+// однородна, поэтому веса точек одинаковы.
+func (spec CoherenceSpec) sourceAngles() [][2]float64 {
+	if !spec.extended() {
+		return [][2]float64{{0, 0}}
+	}
+	n := spec.SourceSamples
+	step := spec.AngularSize / float64(n)
+	node := func(i int) float64 { return (float64(i)+0.5)*step - spec.AngularSize/2 }
+
+	var angles [][2]float64
+	for i := range n {
+		if spec.Source == "slit" {
+			angles = append(angles, [2]float64{node(i), 0})
+			continue
+		}
+		for j := range n {
+			if math.Hypot(node(i), node(j)) <= spec.AngularSize/2 {
+				angles = append(angles, [2]float64{node(i), node(j)})
+			}
+		}
+	}
+	return angles
+}
+
+// bandWavelengths делит полосу ±Bandwidth вокруг wl на равные промежутки;
+// веса — гауссов контур в узлах, сумма весов равна 1
+func (spec CoherenceSpec) bandWavelengths(wl float64) []SpectralSample {
+	if spec.Bandwidth == 0 || spec.BandSamples == 1 {
+		return []SpectralSample{{Lambda: wl, Weight: 1}}
+	}
+	sigma := spec.Bandwidth / (2 * math.Sqrt(2*math.Ln2))
+	samples := make([]SpectralSample, spec.BandSamples)
+	var total float64
+	for i := range samples {
+		d := spec.Bandwidth * (2*float64(i)/float64(spec.BandSamples-1) - 1)
+		samples[i] = SpectralSample{Lambda: wl + d, Weight: math.Exp(-d * d / (2 * sigma * sigma))}
+		total += samples[i].Weight
+	}
+	for i := range samples {
+		samples[i].Weight /= total
+	}
+	return samples
+}
+
+// Когерентный вклад: длина волны, сдвиг картины на экране и вес
+type coherentContribution struct {
+	wavelength     float64
+	shiftX, shiftY float64
+	weight         float64
+}
+
+// coherentContributions перечисляет пары «длина волны — точка источника»
+func (c *Config) coherentContributions() []coherentContribution {
+	angles := c.Coherence.sourceAngles()
+	var contributions []coherentContribution
+	for _, band := range c.Coherence.bandWavelengths(c.Wavelength) {
+		for _, a := range angles {
+			contributions = append(contributions, coherentContribution{
+				wavelength: band.Lambda,
+				shiftX:     c.Distance * a[0],
+				shiftY:     c.Distance * a[1],
+				weight:     band.Weight / float64(len(angles)),
+			})
+		}
+	}
+	return contributions
+}
+
+// contribution возвращает когерентный расчёт одного вклада. Точки края
+// и препятствие общие, вклад считается локально в workers потоках.
+// Интенсивность не считается только в общей тени umbra: в полутени тень
+// одного вклада освещена другими.
+func (s *Simulation) contribution(c coherentContribution, workers int, umbra [][]bool) *Simulation {
+	sub := *s
+	sub.Wavelength = c.wavelength
+	sub.offsetX, sub.offsetY = s.offsetX+c.shiftX, s.offsetY+c.shiftY
+	sub.contributions, sub.umbra = nil, umbra
+	sub.checkpoint, sub.remotes = nil, nil
+	sub.log = io.Discard
+	sub.Workers = workers
+	return &sub
+}
+
+// skipShadow сообщает, что пиксель (x, y) в тени и интенсивность в нём,
+// кроме пятна Пуассона, не нужна
+func (s *Simulation) skipShadow(x, y int, opaque bool) bool {
+	if s.umbra != nil {
+		return s.umbra[y][x]
+	}
+	return opaque
+}
+
+// intensityWithError возвращает интенсивность и её стандартную ошибку
+// в точке экрана (x, y) с учётом частичной когерентности. Все вклады
+// считаются по одним и тем же точкам края, поэтому их ошибки коррелированы
+// и складываются линейно.
+func (s *Simulation) intensityWithError(x, y float64) (float64, float64) {
+	if s.contributions == nil {
+		re, im, se := s.AmplitudeWithError(x, y)
+		return re*re + im*im, se
+	}
+	var intens, stdErr float64
+	for _, c := range s.contributions {
+		re, im, se := s.contribution(c, s.Workers, nil).AmplitudeWithError(x-c.shiftX, y-c.shiftY)
+		intens += c.weight * (re*re + im*im)
+		stdErr += c.weight * se
+	}
+	return intens, stdErr
+}
+
+// computePartiallyCoherentField считает поле каждого когерентного вклада
+// выбранным методом и складывает интенсивности. Вклады независимы
+// и считаются одновременно, потоки делятся между ними поровну. Комплексной
+// амплитуды у суммы нет, Re и Im остаются nil. Тенью считаются пиксели,
+// которые затенены для всех вкладов и остались тёмными: размытое пятно
+// Пуассона в тень не попадает.
+func (s *Simulation) computePartiallyCoherentField(ctx context.Context) *Field {
+	n := len(s.contributions)
+	concurrency := min(s.Workers, n)
+	workers := max(1, s.Workers/concurrency)
+	s.logf("Частичная когерентность: %d когерентных вкладов, одновременно %d по %d потоков\n", n, concurrency, workers)
+
+	// Общая тень: пиксели, затенённые для всех точек источника
+	scale := s.ScreenWidth / float64(s.Width)
+	umbra := make([][]bool, s.Height)
+	s.parallelRows(s.Height, func(y int) {
+		umbra[y] = make([]bool, s.Width)
+		for x := range umbra[y] {
+			xPos, yPos := s.screenPosition(x, y, scale)
+			umbra[y][x] = true
+			for _, c := range s.contributions {
+				if !s.obstacle.Opaque(xPos-c.shiftX, yPos-c.shiftY) {
+					umbra[y][x] = false
+					break
+				}
+			}
+		}
+	})
+
+	field := &Field{
+		Intensity: make([][]float64, s.Height),
+		StdErr:    make([][]float64, s.Height),
+		Opaque:    make([][]bool, s.Height),
+	}
+	for y := range field.Intensity {
+		field.Intensity[y] = make([]float64, s.Width)
+		field.StdErr[y] = make([]float64, s.Width)
+		field.Opaque[y] = append([]bool(nil), umbra[y]...)
+	}
+
+	queue := make(chan int, n)
+	for i := range n {
+		queue <- i
+	}
+	close(queue)
+
+	bar := progressbar.NewOptions(
+		n,
+		progressbar.OptionSetWriter(s.log),
+		progressbar.OptionSetDescription("Когерентные вклады..."),
+		progressbar.OptionSetWidth(30),
+		progressbar.OptionThrottle(100*time.Millisecond),
+	)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if ctx.Err() != nil {
+					return
+				}
+				c := s.contributions[i]
+				part := s.contribution(c, workers, umbra).Field(ctx)
+				if part.Partial {
+					return
+				}
+				mu.Lock()
+				for y := range part.Intensity {
+					for x, intens := range part.Intensity[y] {
+						field.Intensity[y][x] += c.weight * intens
+						field.StdErr[y][x] += c.weight * part.StdErr[y][x]
+					}
+				}
+				mu.Unlock()
+				_ = bar.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	s.logf("\n")
+
+	field.Partial = ctx.Err() != nil
+	for y := range field.Intensity {
+		for x, intens := range field.Intensity[y] {
+			if !field.Opaque[y][x] {
+				field.MaxIntensity = math.Max(field.MaxIntensity, intens)
+			} else if intens > 0 { // пятно Пуассона, как и у когерентного поля, в максимум не входит
+				field.Opaque[y][x] = false
+			}
+		}
+	}
+	if field.MaxIntensity == 0 {
+		field.MaxIntensity = 1
+	}
+	return field
+}
@@ -0,0 +1,331 @@
+package diffraction
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	remoteMaxFailures = 3                // подряд неудачных запросов, после которых процесс исключается
+	remoteRetryDelay  = time.Second      // пауза перед повторным запросом к процессу после ошибки
+	remoteTimeout     = 10 * time.Minute // предельное время расчёта одной плитки
+)
+
+// Запрос плитки у рабочего процесса
+type tileRequest struct {
+	Params renderParams
+	Tile   tile
+}
+
+// Ответ рабочего процесса на /info
+type workerInfo struct {
+	Workers int
+}
+
+// Рабочий процесс, к которому координатор отправляет плитки
+type remoteWorker struct {
+	url      string
+	slots    int // одновременных запросов — по числу потоков процесса
+	failures int
+	alive    bool
+}
+
+// Пул рабочих процессов. Каждый свободный поток процесса представлен
+// элементом канала slots; плитка, расчёт которой не удался, сразу
+// передаётся следующему свободному процессу.
+type remotePool struct {
+	sim      *Simulation // считает плитки локально, если процессов не осталось
+	params   renderParams
+	client   *http.Client
+	mu       sync.Mutex
+	workers  []*remoteWorker
+	slots    chan *remoteWorker
+	dead     chan struct{} // закрывается, когда не осталось ни одного процесса
+	deadOnce sync.Once
+}
+
+// connectRemotes опрашивает рабочие процессы и строит пул из доступных
+func (s *Simulation) connectRemotes() (*remotePool, error) {
+	p := &remotePool{
+		sim:    s,
+		params: s.renderParams(),
+		client: &http.Client{Timeout: remoteTimeout},
+		dead:   make(chan struct{}),
+	}
+	total := 0
+	for _, url := range s.Remotes {
+		url = strings.TrimSuffix(url, "/")
+		info, err := p.info(url)
+		if err != nil {
+			s.logf("Рабочий процесс %s недоступен: %v\n", url, err)
+			continue
+		}
+		w := &remoteWorker{url: url, slots: max(1, info.Workers), alive: true}
+		p.workers = append(p.workers, w)
+		total += w.slots
+		s.logf("Рабочий процесс %s: %d потоков\n", url, w.slots)
+	}
+	if len(p.workers) == 0 {
+		return nil, fmt.Errorf("ни один рабочий процесс не отвечает")
+	}
+
+	p.slots = make(chan *remoteWorker, total)
+	for _, w := range p.workers {
+		for range w.slots {
+			p.slots <- w
+		}
+	}
+	return p, nil
+}
+
+func (p *remotePool) info(url string) (workerInfo, error) {
+	var info workerInfo
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url + "/info")
+	if err != nil {
+		return info, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("ответ %s", resp.Status)
+	}
+	return info, json.NewDecoder(resp.Body).Decode(&info)
+}
+
+// capacity — сколько плиток можно считать одновременно
+func (p *remotePool) capacity() int { return cap(p.slots) }
+
+// acquire ждёт свободный поток живого процесса; nil — если процессов
+// не осталось или расчёт отменён
+func (p *remotePool) acquire(ctx context.Context) *remoteWorker {
+	for {
+		select {
+		case w := <-p.slots:
+			p.mu.Lock()
+			alive := w.alive
+			p.mu.Unlock()
+			if alive {
+				return w
+			}
+			// Поток исключённого процесса просто выбрасывается
+		case <-p.dead:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (p *remotePool) release(w *remoteWorker) {
+	p.mu.Lock()
+	w.failures = 0
+	p.mu.Unlock()
+	p.slots <- w
+}
+
+// fail учитывает ошибку процесса и исключает его после remoteMaxFailures ошибок подряд
+func (p *remotePool) fail(w *remoteWorker, err error) {
+	p.mu.Lock()
+	w.failures++
+	if w.alive && w.failures >= remoteMaxFailures {
+		w.alive = false
+		p.sim.logf("\nРабочий процесс %s исключён: %v\n", w.url, err)
+		if !p.anyAlive() {
+			p.sim.logf("Рабочих процессов не осталось, оставшиеся плитки считаются локально\n")
+			p.deadOnce.Do(func() { close(p.dead) })
+		}
+	}
+	alive := w.alive
+	p.mu.Unlock()
+
+	if alive {
+		time.Sleep(remoteRetryDelay)
+		p.slots <- w
+	}
+}
+
+func (p *remotePool) anyAlive() bool {
+	for _, w := range p.workers {
+		if w.alive {
+			return true
+		}
+	}
+	return false
+}
+
+// renderTile отправляет плитку свободному процессу, при ошибке — другому.
+// Если живых процессов не осталось, плитка считается локально.
+// Возвращает false, если расчёт отменён и плитка не готова.
+func (p *remotePool) renderTile(ctx context.Context, levels [][]Point, t tile, store func(tile, tileResult)) bool {
+	for {
+		w := p.acquire(ctx)
+		if ctx.Err() != nil {
+			if w != nil {
+				p.slots <- w
+			}
+			return false
+		}
+		if w == nil {
+			store(t, p.sim.computeTile(levels, t))
+			return true
+		}
+
+		r, err := p.request(ctx, w, t)
+		if err == nil {
+			p.release(w)
+			store(t, r)
+			return true
+		}
+		if ctx.Err() != nil {
+			p.slots <- w
+			return false
+		}
+		p.fail(w, err)
+	}
+}
+
+func (p *remotePool) request(ctx context.Context, w *remoteWorker, t tile) (tileResult, error) {
+	var r tileResult
+	body, err := json.Marshal(tileRequest{Params: p.params, Tile: t})
+	if err != nil {
+		return r, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url+"/tile", bytes.NewReader(body))
+	if err != nil {
+		return r, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return r, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var msg bytes.Buffer
+		msg.ReadFrom(resp.Body)
+		return r, fmt.Errorf("ответ %s: %s", resp.Status, strings.TrimSpace(msg.String()))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return r, err
+	}
+	if n := t.pixels(); len(r.Intensity) != n || len(r.StdErr) != n || len(r.Re) != n || len(r.Im) != n || len(r.Samples) != n {
+		return r, fmt.Errorf("неверный размер плитки в ответе")
+	}
+	return r, nil
+}
+
+// Состояние рабочего процесса: расчёт текущего задания и уровни выборки края.
+// Плитки одного задания считаются параллельно под блокировкой на чтение.
+type workerServer struct {
+	workers int
+	log     io.Writer
+	mu      sync.RWMutex
+	params  *renderParams
+	sim     *Simulation
+	levels  [][]Point
+}
+
+// Ограничения времени соединения рабочего процесса: плитка должна успеть
+// посчитаться за remoteTimeout, остальное — быстрые операции
+const (
+	workerReadTimeout = 30 * time.Second
+	workerIdleTimeout = 2 * time.Minute
+)
+
+// ServeWorker запускает рабочий процесс, который считает плитки по запросам
+// координатора в workers потоках (0 — по числу ядер). Параметры расчёта
+// приходят вместе с плитками, их размер ограничен так же, как в сервисе.
+func ServeWorker(addr string, workers int, log io.Writer) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if log == nil {
+		log = io.Discard
+	}
+	fmt.Fprintf(log, "Рабочий процесс слушает %s, потоков: %d\n", addr, workers)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           newWorkerHandler(workers, log),
+		ReadHeaderTimeout: workerReadTimeout,
+		ReadTimeout:       workerReadTimeout,
+		WriteTimeout:      remoteTimeout,
+		IdleTimeout:       workerIdleTimeout,
+	}
+	return server.ListenAndServe()
+}
+
+// newWorkerHandler возвращает обработчик запросов рабочего процесса
+func newWorkerHandler(workers int, log io.Writer) http.Handler {
+	s := &workerServer{workers: workers, log: log}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(workerInfo{Workers: workers})
+	})
+	mux.HandleFunc("POST /tile", s.handleTile)
+	return mux
+}
+
+func (s *workerServer) handleTile(w http.ResponseWriter, r *http.Request) {
+	var req tileRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, serviceMaxBody)).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for {
+		s.mu.RLock()
+		if s.params != nil && *s.params == req.Params {
+			break // блокировка на чтение удерживается до конца расчёта
+		}
+		s.mu.RUnlock()
+
+		s.mu.Lock()
+		if s.params == nil || *s.params != req.Params {
+			cfg := req.Params.config()
+			cfg.Workers = s.workers
+			err := cfg.Validate()
+			if err == nil {
+				err = cfg.checkLimits()
+			}
+			if err == nil && req.Params.Seed == 0 {
+				err = errors.New("в задании не указан seed")
+			}
+			var sim *Simulation
+			if err == nil {
+				sim, err = New(WithConfig(cfg))
+			}
+			if err != nil {
+				s.mu.Unlock()
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			s.sim, s.levels, s.params = sim, sim.sampleLevels(), &req.Params
+			fmt.Fprintf(s.log, "Новое задание: %d×%d пикселей, %d точек края, seed: %d\n", sim.Width, sim.Height, sim.Samples, sim.Seed)
+		}
+		s.mu.Unlock()
+	}
+	defer s.mu.RUnlock()
+
+	t := req.Tile
+	if t.X0 < 0 || t.Y0 < 0 || t.X1 > s.sim.Width || t.Y1 > s.sim.Height || t.X0 >= t.X1 || t.Y0 >= t.Y1 {
+		http.Error(w, "плитка выходит за пределы изображения", http.StatusBadRequest)
+		return
+	}
+	// Если координатор отменил расчёт или отключился, плитка не досчитывается
+	result, err := s.sim.computeTileContext(r.Context(), s.levels, t)
+	if err != nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
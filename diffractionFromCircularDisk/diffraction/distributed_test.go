@@ -0,0 +1,88 @@
+package diffraction
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Поле, собранное из плиток рабочих процессов, совпадает с локальным
+func TestDistributedField(t *testing.T) {
+	live := httptest.NewServer(newWorkerHandler(2, io.Discard))
+	defer live.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close() // адрес, на котором никто не отвечает
+
+	cases := []struct {
+		name    string
+		opts    []Option
+		remotes []string
+	}{
+		{"диск", nil, []string{live.URL}},
+		{"адаптивная выборка", []Option{WithAdaptive(0.05, 8000)}, []string{live.URL}},
+		{"многоугольник", []Option{WithObstacle(ObstacleSpec{Kind: "polygon", Sides: 6})}, []string{live.URL}},
+		{"недоступный процесс", nil, []string{down.URL, live.URL}},
+	}
+	ctx := context.Background()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]Option{WithSize(64, 40), func(c *Config) { c.Radial = false }}, tc.opts...)
+			want := testSimulation(t, opts...).Field(ctx)
+			got := testSimulation(t, append(opts, WithRemotes(tc.remotes...))...).Field(ctx)
+			if got.Partial {
+				t.Fatalf("распределённый расчёт не закончен")
+			}
+			if got.MaxIntensity != want.MaxIntensity {
+				t.Errorf("максимум интенсивности %g, локально %g", got.MaxIntensity, want.MaxIntensity)
+			}
+			for y := range want.Intensity {
+				for x := range want.Intensity[y] {
+					if a, b := got.Intensity[y][x], want.Intensity[y][x]; a != b {
+						t.Fatalf("пиксель (%d, %d): %g от рабочих процессов и %g локально", x, y, a, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+// Рабочий процесс отклоняет задания больше ограничений сервиса и плитки
+// вне изображения
+func TestWorkerRejects(t *testing.T) {
+	params := testSimulation(t, WithSize(64, 64)).renderParams()
+	cases := []struct {
+		name   string
+		modify func(r *tileRequest)
+		want   string
+	}{
+		{"изображение больше допустимого", func(r *tileRequest) { r.Params.Width, r.Params.Height = 1<<32, 1<<32 }, "изображение"},
+		{"точек края больше допустимого", func(r *tileRequest) { r.Params.Samples, r.Params.MaxSamples = 2*serviceMaxSamples, 2*serviceMaxSamples }, "точек края"},
+		{"предел адаптивной выборки больше допустимого", func(r *tileRequest) { r.Params.Adaptive, r.Params.MaxSamples = 0.01, 2*serviceMaxSamples }, "точек края"},
+		{"без seed", func(r *tileRequest) { r.Params.Seed = 0 }, "seed"},
+		{"плитка вне изображения", func(r *tileRequest) { r.Tile = tile{X0: 48, Y0: 0, X1: 80, Y1: 32} }, "плитка"},
+		{"пустая плитка", func(r *tileRequest) { r.Tile = tile{X0: 32, Y0: 0, X1: 32, Y1: 32} }, "плитка"},
+	}
+	h := newWorkerHandler(1, io.Discard)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := tileRequest{Params: params, Tile: tile{X0: 0, Y0: 0, X1: 32, Y1: 32}}
+			tc.modify(&req)
+			body, err := json.Marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/tile", strings.NewReader(string(body))))
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("ответ %d, ожидается %d", w.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("ошибка %q не содержит %q", strings.TrimSpace(w.Body.String()), tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package diffraction
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Запись двумерного массива в файл; массив хранится по строкам изображения
+type fieldWriter struct {
+	ext   string
+	write func(w io.Writer, data [][]float64) error
+}
+
+// fieldWriter возвращает запись в формате format; ok = false, если формат неизвестен
+func (s *Simulation) fieldWriter(format string) (w fieldWriter, ok bool) {
+	switch format {
+	case "csv":
+		return fieldWriter{".csv", writeCSV}, true
+	case "npy":
+		return fieldWriter{".npy", writeNPY}, true
+	case "fits":
+		return fieldWriter{".fits", s.writeFITS}, true
+	case "png16":
+		return fieldWriter{".png", writePNG16}, true
+	}
+	return fieldWriter{}, false
+}
+
+// ValidateExport проверяет форматы экспорта и вид амплитуды
+func ValidateExport(formats []string, complexMode string) error {
+	for _, f := range formats {
+		if _, ok := (*Simulation)(nil).fieldWriter(f); !ok {
+			return fmt.Errorf("неизвестный формат экспорта %q (ожидается csv, npy, fits или png16)", f)
+		}
+	}
+	switch complexMode {
+	case "", "reim", "magphase":
+		return nil
+	}
+	return fmt.Errorf("неизвестный вид амплитуды %q (ожидается reim или magphase)", complexMode)
+}
+
+// Экспортируемая величина: суффикс имени файла и значение в пикселе
+type fieldArray struct {
+	suffix string
+	value  func(x, y int) float64
+}
+
+// ExportField сохраняет интенсивность и, при необходимости, амплитуду
+// (complexMode: reim или magphase) в каждом из форматов в файлы
+// base_<величина>.<расширение>. Пиксели тени не рассчитываются
+// и записываются как NaN (в 16-битном PNG — как 0).
+func (s *Simulation) ExportField(field *Field, base string, formats []string, complexMode string) error {
+	if err := ValidateExport(formats, complexMode); err != nil {
+		return err
+	}
+	if len(formats) == 0 {
+		return nil
+	}
+
+	arrays := []fieldArray{
+		{"intensity", func(x, y int) float64 { return field.Intensity[y][x] }},
+	}
+	if complexMode != "" && field.Re == nil {
+		return fmt.Errorf("у частично когерентного поля нет комплексной амплитуды")
+	}
+	switch complexMode {
+	case "reim":
+		arrays = append(arrays,
+			fieldArray{"re", func(x, y int) float64 { return field.Re[y][x] }},
+			fieldArray{"im", func(x, y int) float64 { return field.Im[y][x] }},
+		)
+	case "magphase":
+		arrays = append(arrays,
+			fieldArray{"magnitude", func(x, y int) float64 { return math.Hypot(field.Re[y][x], field.Im[y][x]) }},
+			fieldArray{"phase", func(x, y int) float64 { return math.Atan2(field.Im[y][x], field.Re[y][x]) }},
+		)
+	}
+
+	for _, a := range arrays {
+		data := make([][]float64, s.Height)
+		for y := range data {
+			data[y] = make([]float64, s.Width)
+			for x := range data[y] {
+				if field.Opaque[y][x] {
+					data[y][x] = math.NaN()
+					continue
+				}
+				data[y][x] = a.value(x, y)
+			}
+		}
+
+		for _, format := range formats {
+			w, _ := s.fieldWriter(format)
+			if format == "png16" && a.suffix != "intensity" {
+				continue // в 16-битный PNG пишется только интенсивность
+			}
+			filename := base + "_" + a.suffix + w.ext
+			if err := saveFieldFile(filename, data, w); err != nil {
+				return err
+			}
+			s.logf("Данные поля сохранены в %s\n", filename)
+		}
+	}
+	return nil
+}
+
+func saveFieldFile(filename string, data [][]float64, w fieldWriter) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := bufio.NewWriter(f)
+	if err := w.write(buf, data); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeCSV(w io.Writer, data [][]float64) error {
+	for _, row := range data {
+		fields := make([]string, len(row))
+		for x, v := range row {
+			fields[x] = strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(fields, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNPY пишет массив в формате NumPy .npy версии 1.0 (float64, little-endian)
+func writeNPY(w io.Writer, data [][]float64) error {
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%d, %d), }", len(data), len(data[0]))
+	// Длина магии, версии, поля длины и заголовка кратна 64, заголовок кончается \n
+	const prefix = 10
+	pad := 64 - (prefix+len(header)+1)%64
+	header += strings.Repeat(" ", pad%64) + "\n"
+
+	if _, err := w.Write([]byte("\x93NUMPY\x01\x00")); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(header))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	for _, row := range data {
+		if err := binary.Write(w, binary.LittleEndian, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFITS пишет первичный HDU FITS с BITPIX = -64. Строки записываются
+// снизу вверх, чтобы в просмотрщиках FITS картина выглядела как в PNG.
+func (s *Simulation) writeFITS(w io.Writer, data [][]float64) error {
+	const block = 2880
+	cards := []string{
+		fitsCard("SIMPLE", "T", "conforms to FITS standard"),
+		fitsCard("BITPIX", "-64", "IEEE double precision"),
+		fitsCard("NAXIS", "2", ""),
+		fitsCard("NAXIS1", strconv.Itoa(len(data[0])), "image width"),
+		fitsCard("NAXIS2", strconv.Itoa(len(data)), "image height"),
+		fitsCard("WAVELEN", fitsFloat(s.Wavelength), "wavelength [m]"),
+		fitsCard("RADIUS", fitsFloat(s.Radius), "obstacle radius [m]"),
+		fitsCard("DISTANCE", fitsFloat(s.Distance), "obstacle to screen distance [m]"),
+		fitsCard("SCREENW", fitsFloat(s.ScreenWidth), "screen width [m]"),
+		fitsCard("SAMPLES", strconv.Itoa(s.Samples), "edge samples"),
+		fitsCard("SEED", strconv.FormatInt(s.Seed, 10), "random seed"),
+		fmt.Sprintf("%-80s", "END"),
+	}
+	header := strings.Join(cards, "")
+	header += strings.Repeat(" ", (block-len(header)%block)%block)
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	for y := len(data) - 1; y >= 0; y-- {
+		if err := binary.Write(w, binary.BigEndian, data[y]); err != nil {
+			return err
+		}
+	}
+	size := len(data) * len(data[0]) * 8
+	_, err := w.Write(make([]byte, (block-size%block)%block))
+	return err
+}
+
+// fitsCard формирует 80-символьную запись заголовка (комментарии FITS
+// допускают только ASCII)
+func fitsCard(key, value, comment string) string {
+	card := fmt.Sprintf("%-8s= %20s", key, value)
+	if comment != "" {
+		card += " / " + comment
+	}
+	return fmt.Sprintf("%-80.80s", card)
+}
+
+func fitsFloat(v float64) string { return strconv.FormatFloat(v, 'E', 10, 64) }
+
+// writePNG16 пишет 16-битный PNG в оттенках серого с линейной шкалой:
+// 65535 соответствует максимальной интенсивности
+func writePNG16(w io.Writer, data [][]float64) error {
+	var maxV float64
+	for _, row := range data {
+		for _, v := range row {
+			if !math.IsNaN(v) {
+				maxV = math.Max(maxV, v)
+			}
+		}
+	}
+	if maxV == 0 {
+		maxV = 1
+	}
+
+	img := image.NewGray16(image.Rect(0, 0, len(data[0]), len(data)))
+	for y, row := range data {
+		for x, v := range row {
+			if math.IsNaN(v) {
+				continue
+			}
+			img.SetGray16(x, y, color.Gray16{Y: uint16(math.Round(65535 * v / maxV))})
+		}
+	}
+	return png.Encode(w, img)
+}
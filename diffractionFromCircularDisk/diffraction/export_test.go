@@ -0,0 +1,113 @@
+package diffraction
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportField(t *testing.T) {
+	sim := testSimulation(t, WithSize(20, 12))
+	field := sim.Field(context.Background())
+	base := filepath.Join(t.TempDir(), "field")
+	if err := sim.ExportField(field, base, []string{"csv", "npy", "fits", "png16"}, "reim"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"intensity", "re", "im"} {
+		npy, err := os.ReadFile(base + "_" + name + ".npy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkNPY(t, npy, 12, 20)
+
+		fits, err := os.ReadFile(base + "_" + name + ".fits")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFITS(t, fits, 12, 20)
+	}
+
+	csv, err := os.ReadFile(base + "_intensity.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(csv), "\n"); lines != 12 {
+		t.Errorf("в CSV %d строк, ожидается 12", lines)
+	}
+	if _, err := os.Stat(base + "_intensity.png"); err != nil {
+		t.Errorf("16-битный PNG не сохранён: %v", err)
+	}
+	if _, err := os.Stat(base + "_re.png"); err == nil {
+		t.Errorf("в 16-битный PNG пишется только интенсивность")
+	}
+}
+
+func TestExportFieldErrors(t *testing.T) {
+	sim := testSimulation(t, WithSize(4, 4))
+	field := sim.Field(context.Background())
+	base := filepath.Join(t.TempDir(), "field")
+	if err := sim.ExportField(field, base, []string{"hdf5"}, ""); err == nil {
+		t.Errorf("неизвестный формат: ожидалась ошибка")
+	}
+	if err := sim.ExportField(field, base, []string{"npy"}, "polar"); err == nil {
+		t.Errorf("неизвестный вид амплитуды: ожидалась ошибка")
+	}
+	field.Re, field.Im = nil, nil
+	if err := sim.ExportField(field, base, []string{"npy"}, "reim"); err == nil {
+		t.Errorf("поле без комплексной амплитуды: ожидалась ошибка")
+	}
+}
+
+// checkNPY проверяет магию, версию, выравнивание заголовка и размер данных .npy
+func checkNPY(t *testing.T, data []byte, rows, cols int) {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("\x93NUMPY\x01\x00")) {
+		t.Fatalf("нет магии NumPy версии 1.0: % x", data[:min(8, len(data))])
+	}
+	n := int(binary.LittleEndian.Uint16(data[8:10]))
+	if (10+n)%64 != 0 {
+		t.Errorf("длина заголовка .npy %d не выравнивает данные на 64 байта", 10+n)
+	}
+	header := string(data[10 : 10+n])
+	if !strings.HasSuffix(header, "\n") {
+		t.Errorf("заголовок .npy не заканчивается переводом строки")
+	}
+	for _, want := range []string{"'descr': '<f8'", "'fortran_order': False", "'shape': (12, 20)"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("заголовок .npy %q не содержит %s", header, want)
+		}
+	}
+	if size := len(data) - 10 - n; size != rows*cols*8 {
+		t.Errorf("данных в .npy %d байт, ожидается %d", size, rows*cols*8)
+	}
+}
+
+// checkFITS проверяет, что файл FITS состоит из блоков по 2880 байт
+// и заголовок описывает массив float64 нужного размера
+func checkFITS(t *testing.T, data []byte, rows, cols int) {
+	t.Helper()
+	const block = 2880
+	if len(data)%block != 0 {
+		t.Errorf("размер FITS %d байт не кратен %d", len(data), block)
+	}
+	if want := block + (rows*cols*8+block-1)/block*block; len(data) != want {
+		t.Errorf("размер FITS %d байт, ожидается %d", len(data), want)
+	}
+	header := string(data[:block])
+	for _, want := range []string{"SIMPLE  =", "BITPIX  =                  -64", "NAXIS1  =                   20", "NAXIS2  =                   12", "END"} {
+		if !strings.Contains(header, want) {
+			t.Errorf("заголовок FITS не содержит %q", want)
+		}
+	}
+	for i := 0; i < len(header); i += 80 {
+		if card := header[i : i+80]; strings.TrimSpace(card) == "END" {
+			return
+		}
+	}
+	t.Errorf("в заголовке FITS нет записи END")
+}
@@ -0,0 +1,287 @@
+package diffraction
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+
+	"github.com/schollz/progressbar/v3"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// Regime — зона дифракции
+type Regime string
+
+const (
+	RegimeAuto       Regime = "auto"       // выбрать по числу Френеля
+	RegimeFresnel    Regime = "fresnel"    // ближняя зона
+	RegimeFraunhofer Regime = "fraunhofer" // дальняя зона
+)
+
+// Число Френеля, ниже которого картина считается дальней зоной
+const fraunhoferThreshold = 0.1
+
+// Сколько декад интенсивности показывает изображение дальней зоны
+const farFieldDecades = 4
+
+func ParseRegime(s string) (Regime, error) {
+	switch r := Regime(s); r {
+	case RegimeAuto, RegimeFresnel, RegimeFraunhofer:
+		return r, nil
+	}
+	return "", fmt.Errorf("неизвестная зона дифракции %q (ожидается auto, fresnel или fraunhofer)", s)
+}
+
+// ChooseRegime выбирает зону по числу Френеля в режиме auto и
+// предупреждает, если явно выбранная зона не соответствует параметрам.
+// Контрольная точка и рабочие процессы нужны только в ближней зоне,
+// поэтому зону стоит выбрать до New. Дальняя зона считается только для
+// плоской когерентной волны и экрана, перпендикулярного оси, в остальных
+// случаях auto всегда выбирает ближнюю.
+func (c *Config) ChooseRegime(log io.Writer) Regime {
+	m := c.FresnelZones()
+	switch {
+	case c.Regime == RegimeAuto && m < fraunhoferThreshold && c.Illumination.plane() && c.Coherence.Coherent() && !c.Geometry.screenTilted():
+		fmt.Fprintf(log, "Число Френеля %.3g < %g: расчёт в дальней зоне (Фраунгофер)\n", m, fraunhoferThreshold)
+		return RegimeFraunhofer
+	case c.Regime == RegimeAuto:
+		return RegimeFresnel
+	case c.Regime == RegimeFraunhofer && m >= fraunhoferThreshold:
+		fmt.Fprintf(log, "Внимание: число Френеля %.3g не мало по сравнению с 1, приближение Фраунгофера неточно, выберите fresnel\n", m)
+	case c.Regime == RegimeFresnel && m < fraunhoferThreshold:
+		fmt.Fprintf(log, "Внимание: число Френеля %.3g мало, экран в дальней зоне; картина будет совпадать с fraunhofer\n", m)
+	}
+	return c.Regime
+}
+
+// Элемент контура: точка и направленный элемент длины dr = (DX, DY),
+// уже умноженный на вес квадратуры и знак контура
+type edgeElement struct{ X, Y, DX, DY float64 }
+
+// Шаг параметра для численной касательной к контуру
+const tangentStep = 1e-6
+
+// generateEdgeElements размещает точки на контурах так же, как
+// generateEdgePoints, и добавляет к ним элементы длины вдоль контура
+func generateEdgeElements(o Obstacle, n int, method SamplingMethod, seed int64, workers int) []edgeElement {
+	contours := o.Contours()
+	elements := make([]edgeElement, 0, n)
+	for i, count := range contourSampleCounts(contours, n) {
+		c := contours[i]
+		t, w := sampleParameters(count, method, streamSeed(seed, int64(i)<<32), workers)
+		for j := range t {
+			x, y := c.At(t[j])
+			x1, y1 := c.At(math.Mod(t[j]+1-tangentStep, 1))
+			x2, y2 := c.At(math.Mod(t[j]+tangentStep, 1))
+			// Касательная нормирована на длину контура: |dr/dt| = Length
+			scale := c.Sign * w[j] * c.Length / math.Hypot(x2-x1, y2-y1)
+			elements = append(elements, edgeElement{X: x, Y: y, DX: scale * (x2 - x1), DY: scale * (y2 - y1)})
+		}
+	}
+	return elements
+}
+
+// hasMask сообщает, построено ли препятствие из PNG-маски: у её контура
+// нет непрерывной касательной, поэтому дальняя зона для неё не считается
+func hasMask(o Obstacle) bool {
+	switch o := o.(type) {
+	case *Mask:
+		return true
+	case Complement:
+		return hasMask(o.Of)
+	}
+	return false
+}
+
+// farFieldAmplitude возвращает преобразование Фурье пропускания в точке
+// пространственных частот (qx, qy) без постоянной плоской волны.
+// Интеграл по площади сводится к контурному по формуле Грина:
+// ∫ e^{-iq·r} dA = (i/q²) ∮ (e^{-iq·r} - 1)(qx dy - qy dx);
+// вычитание 1 не меняет интеграла, но убирает особенность при q → 0.
+func farFieldAmplitude(elements []edgeElement, qx, qy float64) (float64, float64) {
+	q2 := qx*qx + qy*qy
+	var re, im float64
+	if q2 == 0 {
+		// Предел при q → 0 — площадь, ∮ x dy
+		for _, e := range elements {
+			re += e.X * e.DY
+		}
+		return -re, 0
+	}
+	for _, e := range elements {
+		phase := qx*e.X + qy*e.Y
+		s := math.Sin(phase / 2)
+		// e^{-iφ} - 1 = -2sin²(φ/2) - i sin φ
+		cRe, cIm := -2*s*s, -math.Sin(phase)
+		flux := qx*e.DY - qy*e.DX
+		// Умножение на i: (a + ib)·i = -b + ia
+		re += -cIm * flux
+		im += cRe * flux
+	}
+	// Знак контура +1 означает непрозрачную область, она вычитается
+	return -re / q2, -im / q2
+}
+
+// FarField считает картину Фраунгофера на экране на расстоянии Distance:
+// точке экрана (x, y) соответствует q = k(x, y)/z. Интенсивность нормирована
+// на интенсивность в центре картины отверстия той же формы (I/I(0)).
+func (s *Simulation) FarField() (*Field, error) {
+	if hasMask(s.obstacle) {
+		return nil, errors.New("дальняя зона для PNG-маски не поддерживается")
+	}
+	if !s.Illumination.plane() {
+		return nil, errors.New("дальняя зона рассчитывается только для плоской волны")
+	}
+	if s.contributions != nil {
+		return nil, errors.New("дальняя зона рассчитывается только для когерентного освещения")
+	}
+	if s.Geometry.screenTilted() {
+		return nil, errors.New("дальняя зона для повёрнутого экрана не рассчитывается")
+	}
+	elements := generateEdgeElements(s.obstacle, s.Samples, s.Sampling, s.Seed, s.Workers)
+
+	scale := s.ScreenWidth / float64(s.Width)
+	k := 2 * math.Pi / s.Wavelength
+
+	area, _ := farFieldAmplitude(elements, 0, 0)
+	norm := 1 / math.Abs(area)
+
+	field := &Field{
+		Intensity: make([][]float64, s.Height),
+		StdErr:    make([][]float64, s.Height),
+		Re:        make([][]float64, s.Height),
+		Im:        make([][]float64, s.Height),
+		Opaque:    make([][]bool, s.Height), // в дальней зоне геометрической тени нет
+	}
+
+	bar := progressbar.NewOptions(
+		s.Height,
+		progressbar.OptionSetWriter(s.log),
+		progressbar.OptionSetDescription("Обработка строк..."),
+		progressbar.OptionSetWidth(30),
+	)
+	s.parallelRows(s.Height, func(y int) {
+		field.Intensity[y] = make([]float64, s.Width)
+		field.StdErr[y] = make([]float64, s.Width)
+		field.Re[y] = make([]float64, s.Width)
+		field.Im[y] = make([]float64, s.Width)
+		field.Opaque[y] = make([]bool, s.Width)
+		for x := 0; x < s.Width; x++ {
+			xPos, yPos := s.screenPosition(x, y, scale)
+			re, im := farFieldAmplitude(elements, k*xPos/s.Distance, k*yPos/s.Distance)
+			re, im = re*norm, im*norm
+			field.Re[y][x], field.Im[y][x] = re, im
+			field.Intensity[y][x] = re*re + im*im
+		}
+		_ = bar.Add(1)
+	})
+	s.logf("\n")
+
+	for y := range field.Intensity {
+		for _, intens := range field.Intensity[y] {
+			field.MaxIntensity = math.Max(field.MaxIntensity, intens)
+		}
+	}
+	if field.MaxIntensity == 0 {
+		field.MaxIntensity = 1
+	}
+	return field, nil
+}
+
+// FarFieldImage рисует интенсивность в логарифмической шкале: кольца
+// картины Эйри на порядки слабее центрального максимума
+func (s *Simulation) FarFieldImage(field *Field) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			v := 0.0
+			if intens := field.Intensity[y][x] / field.MaxIntensity; intens > 0 {
+				v = 1 + math.Log10(intens)/farFieldDecades
+			}
+			img.Set(x, y, heatColor(v))
+		}
+	}
+	return img
+}
+
+// airyIntensity — картина Эйри круглого отверстия радиуса a: (2J1(v)/v)², v = k a r/z
+func (s *Simulation) airyIntensity(a, r float64) float64 {
+	v := 2 * math.Pi / s.Wavelength * a * r / s.Distance
+	if v == 0 {
+		return 1
+	}
+	j := 2 * math.J1(v) / v
+	return j * j
+}
+
+// airyRadius возвращает аналитический радиус картины Эйри, если препятствие —
+// диск или круглое отверстие (по Бабине картины совпадают)
+func airyRadius(o Obstacle) (float64, bool) {
+	switch o := o.(type) {
+	case Disk:
+		return o.R, true
+	case Complement:
+		if d, ok := o.Of.(Disk); ok {
+			return d.R, true
+		}
+	}
+	return 0, false
+}
+
+// FarFieldPlot строит I/I(0) вдоль центральной линии и, для диска
+// и круглого отверстия, картину Эйри для сравнения
+func (s *Simulation) FarFieldPlot(field *Field) (*plot.Plot, error) {
+	scale := s.ScreenWidth / float64(s.Width)
+	row := s.Height / 2
+	simulated := make(plotter.XYs, s.Width)
+	for x := 0; x < s.Width; x++ {
+		_, _, u := s.linePosition(x, scale)
+		simulated[x] = plotter.XY{X: u * 1000, Y: field.Intensity[row][x]}
+	}
+
+	p := plot.New()
+	p.Title.Text = "Дифракция Фраунгофера"
+	p.X.Label.Text = "Расстояние от центра, мм"
+	p.Y.Label.Text = "I/I(0)"
+
+	line, err := plotter.NewLine(simulated)
+	if err != nil {
+		return nil, err
+	}
+	line.Color = color.RGBA{R: 30, G: 90, B: 200, A: 255}
+	p.Add(plotter.NewGrid(), line)
+	p.Legend.Add("расчёт", line)
+
+	if a, ok := airyRadius(s.obstacle); ok {
+		analytic := make(plotter.XYs, s.Width)
+		var sumSq float64
+		for x := 0; x < s.Width; x++ {
+			xPos, yPos, u := s.linePosition(x, scale)
+			analytic[x] = plotter.XY{X: u * 1000, Y: s.airyIntensity(a, math.Hypot(xPos, yPos))}
+			d := simulated[x].Y - analytic[x].Y
+			sumSq += d * d
+		}
+		airy, err := plotter.NewLine(analytic)
+		if err != nil {
+			return nil, err
+		}
+		airy.Color = color.RGBA{R: 200, G: 40, B: 40, A: 255}
+		airy.Dashes = []vg.Length{vg.Points(3), vg.Points(2)}
+		p.Add(airy)
+		p.Legend.Add("Эйри", airy)
+		s.logf("Радиус первого тёмного кольца Эйри: %.4g м\n", 1.2197*s.Wavelength*s.Distance/(2*a))
+		s.logf("Среднеквадратичное отличие от картины Эйри вдоль центральной линии: %.6f\n", math.Sqrt(sumSq/float64(s.Width)))
+	}
+	p.Legend.Top = true
+
+	p.X.Min = -s.ScreenWidth * 1000 / 2
+	p.X.Max = s.ScreenWidth * 1000 / 2
+	p.Y.Min = 0
+	p.Y.Max = 1.3 // место для легенды
+	return p, nil
+}
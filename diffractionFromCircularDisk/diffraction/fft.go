@@ -0,0 +1,370 @@
+package diffraction
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sync"
+	"time"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// SolverMethod — метод расчёта поля на экране
+type SolverMethod string
+
+const (
+	SolverEdgeSum SolverMethod = "edge"    // сумма по точкам края (Монте-Карло)
+	SolverAngular SolverMethod = "angular" // угловой спектр через БПФ
+	SolverFresnel SolverMethod = "fresnel" // передаточная функция Френеля через БПФ
+)
+
+func ParseSolverMethod(s string) (SolverMethod, error) {
+	switch m := SolverMethod(s); m {
+	case SolverEdgeSum, SolverAngular, SolverFresnel:
+		return m, nil
+	}
+	return "", fmt.Errorf("неизвестный метод расчёта %q (ожидается edge, angular или fresnel)", s)
+}
+
+// Сколько точек контура проверяется при оценке размера препятствия
+const extentSamples = 256
+
+// obstacleExtent возвращает наибольшее удаление края препятствия от оси
+func obstacleExtent(o Obstacle) float64 {
+	var extent float64
+	for _, c := range o.Contours() {
+		for i := range extentSamples {
+			x, y := c.At(float64(i) / extentSamples)
+			extent = math.Max(extent, math.Hypot(x, y))
+		}
+	}
+	return extent
+}
+
+// Квадратная сетка для БПФ с центром в начале координат:
+// узел i находится в точке (i - n/2)·dx
+type fftGrid struct {
+	n  int
+	dx float64
+}
+
+func (g fftGrid) width() float64 { return float64(g.n) * g.dx }
+
+// newFFTGrid подбирает ширину сетки с запасом padding относительно экрана
+// и препятствия. Для периодической сетки поле, ушедшее за её край,
+// возвращается с другой стороны, поэтому сетка берётся шире экрана.
+// Сдвинутая картина расширяет экран на величину сдвига в обе стороны.
+func (s *Simulation) newFFTGrid(n int, padding float64) fftGrid {
+	screenWidth := s.ScreenWidth + 2*math.Abs(s.offsetX)
+	screenHeight := s.ScreenWidth*float64(s.Height)/float64(s.Width) + 2*math.Abs(s.offsetY)
+	span := math.Max(math.Max(screenWidth, screenHeight), 2*obstacleExtent(s.obstacle))
+	return fftGrid{n: n, dx: padding * span / float64(n)}
+}
+
+// checkFFTSampling предупреждает, если сетка не разрешает полосы на краю экрана
+// или ограничение спектра срезает нужные углы распространения
+func (s *Simulation) checkFFTSampling(g fftGrid, wl float64) {
+	screenHalfDiagonal := math.Hypot(s.ScreenWidth, s.ScreenWidth*float64(s.Height)/float64(s.Width))/2 + math.Hypot(s.offsetX, s.offsetY)
+	needed := (screenHalfDiagonal + obstacleExtent(s.obstacle)) / (wl * s.Distance)          // пространственная частота, 1/м
+	needed += obstacleExtent(s.obstacle) * math.Abs(real(s.Illumination.curvature(wl))) / wl // наклон фронта падающей волны на краю
+	if nyquist := 1 / (2 * g.dx); nyquist < needed {
+		s.logf("Внимание: шаг сетки БПФ %.3g м слишком велик (нужна частота %.3g 1/м, доступна %.3g 1/м), увеличьте -fft-grid\n", g.dx, needed, nyquist)
+	}
+	if limit := bandLimit(g, wl, s.Distance); limit < needed {
+		s.logf("Внимание: сетка БПФ слишком узкая (нужна частота %.3g 1/м, доступна %.3g 1/м), увеличьте -fft-padding\n", needed, limit)
+	}
+}
+
+// bandLimit — ограничение углового спектра по Мацусиме (2009): более высокие
+// частоты уходят за край сетки и вернулись бы с другой стороны
+func bandLimit(g fftGrid, wl, distance float64) float64 {
+	df := 1 / g.width()
+	return 1 / (wl * math.Sqrt(math.Pow(2*df*distance, 2)+1))
+}
+
+// sampleOpacity заполняет сетку долей непрозрачной площади каждой ячейки.
+// Ячейки на краю препятствия разбиваются на subcells×subcells частей,
+// чтобы край не превращался в лесенку.
+func (s *Simulation) sampleOpacity(ctx context.Context, g fftGrid) ([][]complex128, error) {
+	const subcells = 4
+	pos := func(i int) float64 { return (float64(i) - float64(g.n)/2 - 0.5) * g.dx } // угол ячейки
+
+	// Непрозрачность в углах ячеек
+	corners := make([][]bool, g.n+1)
+	err := s.parallelRowsContext(ctx, g.n+1, func(y int) {
+		corners[y] = make([]bool, g.n+1)
+		for x := range corners[y] {
+			corners[y][x] = s.obstacle.Opaque(pos(x), pos(y))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	grid := make([][]complex128, g.n)
+	err = s.parallelRowsContext(ctx, g.n, func(y int) {
+		grid[y] = make([]complex128, g.n)
+		for x := range grid[y] {
+			c := corners[y][x]
+			if c == corners[y][x+1] && c == corners[y+1][x] && c == corners[y+1][x+1] {
+				if c {
+					grid[y][x] = 1
+				}
+				continue
+			}
+			count := 0
+			for sy := range subcells {
+				for sx := range subcells {
+					xPos := pos(x) + (float64(sx)+0.5)*g.dx/subcells
+					yPos := pos(y) + (float64(sy)+0.5)*g.dx/subcells
+					if s.obstacle.Opaque(xPos, yPos) {
+						count++
+					}
+				}
+			}
+			grid[y][x] = complex(float64(count)/(subcells*subcells), 0)
+		}
+	})
+	return grid, err
+}
+
+// fft2 выполняет двумерное БПФ на месте: прямое или обратное (без нормировки).
+// После отмены ctx преобразование не доводится до конца.
+func (s *Simulation) fft2(ctx context.Context, grid [][]complex128, inverse bool) error {
+	n := len(grid)
+	transform := func(t *fourier.CmplxFFT, seq []complex128) {
+		if inverse {
+			t.Sequence(seq, seq)
+		} else {
+			t.Coefficients(seq, seq)
+		}
+	}
+
+	// У каждой горутины свой объект БПФ: он хранит рабочие массивы
+	pool := sync.Pool{New: func() any { return fourier.NewCmplxFFT(n) }}
+	err := s.parallelRowsContext(ctx, n, func(y int) {
+		t := pool.Get().(*fourier.CmplxFFT)
+		transform(t, grid[y])
+		pool.Put(t)
+	})
+	if err != nil {
+		return err
+	}
+	return s.parallelRowsContext(ctx, n, func(x int) {
+		t := pool.Get().(*fourier.CmplxFFT)
+		column := make([]complex128, n)
+		for y := range column {
+			column[y] = grid[y][x]
+		}
+		transform(t, column)
+		for y := range column {
+			grid[y][x] = column[y]
+		}
+		pool.Put(t)
+	})
+}
+
+// transferFunction — множитель для пространственной частоты (fx, fy).
+// Фаза, как и у суммы по краю, отсчитывается от плоской волны e^{ikz}.
+func transferFunction(method SolverMethod, fx, fy, wl, z float64) complex128 {
+	f2 := fx*fx + fy*fy
+	if method == SolverFresnel {
+		return cmplx.Exp(complex(0, -math.Pi*wl*z*f2))
+	}
+	k := 2 * math.Pi / wl
+	kz2 := k*k - 4*math.Pi*math.Pi*f2
+	if kz2 < 0 {
+		return complex(math.Exp(-z*math.Sqrt(-kz2)), 0) // затухающие волны
+	}
+	// kz - k = -4π²f²/(kz + k) без потери точности при малых f
+	return cmplx.Exp(complex(0, -z*4*math.Pi*math.Pi*f2/(math.Sqrt(kz2)+k)))
+}
+
+// propagateFFT распространяет поле за препятствием на расстояние Distance.
+// По принципу Бабине поле равно падающей волне минус поле от непрозрачной
+// части: она ограничена (для отверстия — дополняет ограниченное), поэтому
+// периодичность БПФ сказывается меньше. Падающая волна без препятствия
+// распространяется аналитически. Возвращается амплитуда в узлах сетки
+// или ошибка ctx, если расчёт отменён.
+func (s *Simulation) propagateFFT(ctx context.Context, method SolverMethod, g fftGrid, wl float64) ([][]complex128, error) {
+	grid, err := s.sampleOpacity(ctx, g)
+	if err != nil {
+		return nil, err
+	}
+	wave := s.incidentWave(wl)
+	pos := func(i int) float64 { return (float64(i) - float64(g.n)/2) * g.dx }
+	if !wave.plane {
+		s.parallelRows(g.n, func(y int) {
+			for x := range grid[y] {
+				re, im := wave.at(pos(x), pos(y))
+				grid[y][x] *= complex(re, im)
+			}
+		})
+	}
+	if err := s.fft2(ctx, grid, false); err != nil {
+		return nil, err
+	}
+
+	limit := bandLimit(g, wl, s.Distance)
+	freq := func(i int) float64 {
+		if i >= g.n/2 {
+			i -= g.n
+		}
+		return float64(i) / g.width()
+	}
+	s.parallelRows(g.n, func(y int) {
+		fy := freq(y)
+		for x := range grid[y] {
+			fx := freq(x)
+			if math.Abs(fx) > limit || math.Abs(fy) > limit {
+				grid[y][x] = 0
+				continue
+			}
+			grid[y][x] *= transferFunction(method, fx, fy, wl, s.Distance)
+		}
+	})
+
+	if err := s.fft2(ctx, grid, true); err != nil {
+		return nil, err
+	}
+	norm := complex(1/float64(g.n*g.n), 0)
+	s.parallelRows(g.n, func(y int) {
+		for x := range grid[y] {
+			free := complex128(1)
+			if !wave.plane {
+				re, im := wave.geometric(pos(x), pos(y))
+				free = wave.scale * complex(re, im)
+			}
+			grid[y][x] = free - norm*grid[y][x]
+		}
+	})
+	return grid, nil
+}
+
+// interpolate возвращает амплитуду в точке экрана билинейной интерполяцией по сетке
+func (g fftGrid) interpolate(grid [][]complex128, x, y float64) complex128 {
+	gx := x/g.dx + float64(g.n)/2
+	gy := y/g.dx + float64(g.n)/2
+	x0 := min(max(int(math.Floor(gx)), 0), g.n-2)
+	y0 := min(max(int(math.Floor(gy)), 0), g.n-2)
+	fx := complex(gx-float64(x0), 0)
+	fy := complex(gy-float64(y0), 0)
+	top := grid[y0][x0]*(1-fx) + grid[y0][x0+1]*fx
+	bottom := grid[y0+1][x0]*(1-fx) + grid[y0+1][x0+1]*fx
+	return top*(1-fy) + bottom*fy
+}
+
+// computeFFTField считает поле на экране методом БПФ. Ошибки Монте-Карло
+// у него нет, поэтому StdErr остаётся нулевым. Масштаб и пятно Пуассона
+// в тени — как у суммы по краю, чтобы изображения можно было сравнивать.
+// После отмены ctx возвращается пустое поле с Partial = true: незаконченное
+// БПФ не даёт амплитуды ни в одном пикселе.
+func (s *Simulation) computeFFTField(ctx context.Context, method SolverMethod) *Field {
+	g := s.newFFTGrid(s.FFTGrid, s.FFTPadding)
+	s.checkFFTSampling(g, s.Wavelength)
+	s.logf("Сетка БПФ: %d×%d, шаг %.3g м, ширина %.3g м\n", g.n, g.n, g.dx, g.width())
+
+	field := s.newField()
+	field.SamplesUsed = nil // точек края у БПФ нет, адаптивная выборка не используется
+	grid, err := s.propagateFFT(ctx, method, g, s.Wavelength)
+	if err != nil {
+		field.MaxIntensity, field.Partial = 1, true
+		return field
+	}
+
+	scale := s.ScreenWidth / float64(s.Width)
+	diskCenterX, diskCenterY := s.shadowCenter(scale)
+	fresnelFactor := s.fresnelFactorAt(s.Wavelength)
+
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			xPos, yPos := s.screenPosition(x, y, scale)
+			a := complex(fresnelFactor, 0) * g.interpolate(grid, xPos, yPos)
+			intens := real(a)*real(a) + imag(a)*imag(a)
+
+			field.Opaque[y][x] = s.obstacle.Opaque(xPos, yPos)
+			if s.skipShadow(x, y, field.Opaque[y][x]) {
+				if max(abs(x-diskCenterX), abs(y-diskCenterY)) <= poissonRadius {
+					field.Intensity[y][x] = intens * fresnelFactor
+					field.Re[y][x], field.Im[y][x] = spotAmplitude(real(a), imag(a), fresnelFactor)
+				}
+				continue
+			}
+			field.Intensity[y][x] = intens
+			field.Re[y][x], field.Im[y][x] = real(a), imag(a)
+			field.MaxIntensity = math.Max(field.MaxIntensity, intens)
+		}
+	}
+	if field.MaxIntensity == 0 {
+		field.MaxIntensity = 1
+	}
+	return field
+}
+
+// Benchmark считает один и тот же экран суммой по краю, быстрым
+// радиальным путём (для осесимметричных задач) и обоими методами БПФ,
+// сравнивает время и, если есть аналитическое решение, ошибку
+// интенсивности в единицах I/I0. Методы сравниваются на когерентном
+// вкладе точечного источника с длиной волны Wavelength. После отмены ctx
+// оставшиеся методы не запускаются.
+func (s *Simulation) Benchmark(ctx context.Context) {
+	if s.Geometry.screenTilted() {
+		s.logf("Повёрнутый экран считается только суммой по краю, сравнивать методы не с чем\n")
+		return
+	}
+	s.logf("Сравнение методов: %d×%d пикселей, %d точек края, сетка БПФ %d×%d\n", s.Width, s.Height, len(s.points), s.FFTGrid, s.FFTGrid)
+
+	// Сравниваются только вычисления: контрольная точка и рабочие процессы не используются
+	local := *s
+	local.checkpoint, local.remotes, local.contributions = nil, nil, nil
+	if s.contributions != nil {
+		s.logf("Частичная когерентность при сравнении не учитывается: считается когерентное поле\n")
+	}
+
+	exact, ok := local.referenceIntensity()
+	if !ok {
+		s.logf("Аналитическое решение есть только для диска и круглого отверстия, ошибка не оценивается\n")
+	}
+
+	type benchmarkRun struct {
+		name    string
+		compute func() *Field
+	}
+	runs := []benchmarkRun{
+		{string(SolverEdgeSum), func() *Field {
+			return local.computeEdgeSumField(ctx)
+		}},
+	}
+	if isAxisymmetric(s.obstacle) {
+		runs = append(runs, benchmarkRun{"radial", func() *Field {
+			return local.computeRadialField(ctx)
+		}})
+	}
+	for _, method := range []SolverMethod{SolverAngular, SolverFresnel} {
+		runs = append(runs, benchmarkRun{string(method), func() *Field { return local.computeFFTField(ctx, method) }})
+	}
+
+	var edgeTime time.Duration
+	for i, run := range runs {
+		start := time.Now()
+		field := run.compute()
+		elapsed := time.Since(start)
+		if field.Partial {
+			// Время и ошибка недосчитанного поля ничего не говорят о методе
+			s.logf("%-8s прерван, сравнение остановлено\n", run.name)
+			return
+		}
+		if i == 0 {
+			edgeTime = elapsed
+		}
+
+		line := fmt.Sprintf("%-8s %12v  ускорение %6.1f×", run.name, elapsed.Round(time.Millisecond), edgeTime.Seconds()/elapsed.Seconds())
+		if exact != nil {
+			rms, maxErr := s.referenceError(field, exact)
+			line += fmt.Sprintf("  ошибка I/I0: СКО %.4f, макс. %.4f", rms, maxErr)
+		}
+		s.logf("%s\n", line)
+	}
+}
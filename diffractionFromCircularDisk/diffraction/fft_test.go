@@ -0,0 +1,41 @@
+package diffraction
+
+import (
+	"context"
+	"testing"
+)
+
+// benchmarkField считает поле небольшого экрана выбранным методом.
+// Ускорение методов видно по отношению ns/op:
+//
+//	go test -bench Field ./diffraction
+func benchmarkField(b *testing.B, opts ...Option) {
+	sim, err := New(append([]Option{
+		WithSize(64, 64),
+		WithSamples(2000, SamplingRandom),
+		WithSeed(1),
+	}, opts...)...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	for b.Loop() {
+		sim.Field(ctx)
+	}
+}
+
+func BenchmarkFieldEdgeSum(b *testing.B) {
+	benchmarkField(b, func(c *Config) { c.Radial = false })
+}
+
+func BenchmarkFieldRadial(b *testing.B) {
+	benchmarkField(b)
+}
+
+func BenchmarkFieldAngular(b *testing.B) {
+	benchmarkField(b, WithSolver(SolverAngular))
+}
+
+func BenchmarkFieldFresnel(b *testing.B) {
+	benchmarkField(b, WithSolver(SolverFresnel))
+}
@@ -0,0 +1,249 @@
+package diffraction
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+)
+
+// Field — результат расчёта экрана: интенсивность и её стандартная ошибка
+// в каждом пикселе, индексы [y][x]. В тени интенсивность посчитана только
+// для пятна Пуассона.
+type Field struct {
+	Intensity    [][]float64
+	StdErr       [][]float64
+	Re, Im       [][]float64 // комплексная амплитуда
+	Opaque       [][]bool    // геометрическая тень препятствия
+	MaxIntensity float64
+	Partial      bool    // расчёт прерван, часть пикселей не посчитана
+	SamplesUsed  [][]int // точек края на пиксель при адаптивной выборке; nil — выборка фиксированная
+}
+
+// newField выделяет массивы поля; samplesUsed — только при адаптивной выборке
+func (s *Simulation) newField() *Field {
+	field := &Field{
+		Intensity: make([][]float64, s.Height),
+		StdErr:    make([][]float64, s.Height),
+		Re:        make([][]float64, s.Height),
+		Im:        make([][]float64, s.Height),
+		Opaque:    make([][]bool, s.Height),
+	}
+	for y := range field.Intensity {
+		field.Intensity[y] = make([]float64, s.Width)
+		field.StdErr[y] = make([]float64, s.Width)
+		field.Re[y] = make([]float64, s.Width)
+		field.Im[y] = make([]float64, s.Width)
+		field.Opaque[y] = make([]bool, s.Width)
+	}
+	if s.Adaptive > 0 {
+		field.SamplesUsed = make([][]int, s.Height)
+		for y := range field.SamplesUsed {
+			field.SamplesUsed[y] = make([]int, s.Width)
+		}
+	}
+	return field
+}
+
+// amplitudeAtWavelength — то же, что AmplitudeWithError, для длины волны wl
+func (s *Simulation) amplitudeAtWavelength(points []Point, x, y, wl float64) (float64, float64, float64) {
+	var sum edgeSum
+	sum.add(s, points, x, y, wl)
+	return sum.amplitude(s, wl)
+}
+
+// Накопленная по пакетам сумма по краю. Наборы точек можно добавлять
+// по одному: каждый набор весит пропорционально количеству своих точек,
+// поэтому несколько независимых наборов дают ту же оценку, что и один
+// объединённый.
+type edgeSum struct {
+	batchRe, batchIm, batchW [errorBatches]float64
+	x, y, z                  float64 // точка экрана и её расстояние до препятствия
+	n                        int     // добавлено точек
+	first                    int     // точек в первом наборе, его вес равен 1
+	weight                   float64 // сумма весов наборов
+}
+
+// add добавляет вклады набора points в точке экрана (x, y)
+func (sum *edgeSum) add(s *Simulation, points []Point, x, y, wl float64) {
+	k := 2 * math.Pi / wl
+	wave := s.incidentWave(wl)
+	if sum.first == 0 {
+		sum.first = len(points)
+	}
+	sum.x, sum.y, sum.z = x, y, s.distanceAt(x, y)
+	scale := float64(len(points)) / float64(sum.first)
+	boundary := s.boundaryWave()
+
+	// Вычисление амплитуды
+	for i, p := range points {
+		cRe, cIm := edgeContribution(s.Kernel, boundary, x-p.X, y-p.Y, p.TX, p.TY, k, sum.z)
+		if !wave.plane { // вклад края пропорционален падающей на него волне
+			iRe, iIm := wave.at(p.X, p.Y)
+			cRe, cIm = cRe*iRe-cIm*iIm, cRe*iIm+cIm*iRe
+		}
+		batch := (sum.n + i) % errorBatches
+		sum.batchRe[batch] += scale * p.W * cRe
+		sum.batchIm[batch] += scale * p.W * cIm // Суммируем взвешенные вклады от всех точек и получаем суммарную амплитуду в точках
+		sum.batchW[batch] += scale * math.Abs(p.W)
+	}
+	sum.n += len(points)
+	sum.weight += scale
+}
+
+// amplitude возвращает амплитуду и стандартную ошибку интенсивности
+func (sum *edgeSum) amplitude(s *Simulation, wl float64) (float64, float64, float64) {
+	var batchRe, batchIm, batchW [errorBatches]float64
+	var sumRe, sumIm float64
+	for batch := range errorBatches {
+		batchRe[batch] = sum.batchRe[batch] / sum.weight
+		batchIm[batch] = sum.batchIm[batch] / sum.weight
+		batchW[batch] = sum.batchW[batch] / sum.weight
+		sumRe += batchRe[batch]
+		sumIm += batchIm[batch]
+	}
+	bias := s.geometricWave(sum.x, sum.y)
+	re, im := bias+sumRe, sumIm // Краевые вклады добавляются к амплитуде без краёв
+	wave := s.incidentWaveAt(wl, sum.z)
+	if !wave.plane {
+		// Без краёв на экран приходит сферическая волна с центром в источнике
+		gRe, gIm := wave.geometric(sum.x, sum.y)
+		re, im = bias*gRe+sumRe, bias*gIm+sumIm
+	}
+	stdErr := intensityStdErr(batchRe[:], batchIm[:], batchW[:], sumRe, sumIm, re, im, min(sum.n, errorBatches))
+	if !wave.plane {
+		// Расходящаяся волна ослабевает к экрану в M раз по амплитуде
+		a := wave.scale * complex(re, im)
+		re, im = real(a), imag(a)
+		stdErr *= wave.power()
+	}
+
+	// Сумма весов равна 1, поэтому это средняя амплитуда на точке
+	fresnelFactor := s.fresnelFactorAt(wl)
+	f2 := fresnelFactor * fresnelFactor
+	return fresnelFactor * re, fresnelFactor * im, f2 * stdErr
+}
+
+// fresnelFactorAt возвращает множитель амплитуды, затемняющий картину
+// при большом количестве открытых зон Френеля. В физической нормировке
+// множителя нет: амплитуда выражена в единицах волны без препятствия.
+func (s *Simulation) fresnelFactorAt(wl float64) float64 {
+	if s.Normalization == NormalizePhysical {
+		return 1
+	}
+
+	// Количество зон Френеля
+	m := s.fresnelZonesAt(wl)
+
+	// Если количество зон Френеля больше, делаем интенсивность в центре более темной
+	fresnelFactor := 1.0
+	if m > 1 {
+		fresnelFactor = 1 / math.Sqrt(m)
+	}
+	return fresnelFactor
+}
+
+// Радиус пятна Пуассона в пикселях, которое рисуется поверх тени
+const poissonRadius = 3
+
+// spotAmplitude затемняет амплитуду пятна Пуассона так же, как его
+// интенсивность, чтобы |A|² в пикселях пятна совпадал с Intensity
+func spotAmplitude(re, im, fresnelFactor float64) (float64, float64) {
+	f := math.Sqrt(fresnelFactor)
+	return f * re, f * im
+}
+
+// Field считает поле на экране выбранным методом. После отмены ctx расчёт
+// останавливается, а поле возвращается с Partial = true.
+// При частичной когерентности поле — сумма интенсивностей когерентных вкладов.
+func (s *Simulation) Field(ctx context.Context) *Field {
+	switch {
+	case s.contributions != nil:
+		return s.computePartiallyCoherentField(ctx)
+	case s.Solver != SolverEdgeSum:
+		return s.computeFFTField(ctx, s.Solver)
+	case s.radialField():
+		return s.computeRadialField(ctx)
+	}
+	return s.computeEdgeSumField(ctx)
+}
+
+// computeEdgeSumField считает интенсивность во всех пикселях вне тени
+// и в пятне Пуассона в центре тени суммой по точкам края
+func (s *Simulation) computeEdgeSumField(ctx context.Context) *Field {
+	scale := s.ScreenWidth / float64(s.Width)
+	diskCenterX, diskCenterY := s.shadowCenter(scale)
+
+	fresnelFactor := s.fresnelFactorAt(s.Wavelength)
+
+	// Массивы интенсивности, её стандартной ошибки, амплитуды и геометрической тени препятствия
+	field := s.newField()
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			field.Opaque[y][x] = s.obstacle.Opaque(s.screenPosition(x, y, scale))
+		}
+	}
+
+	levels := s.sampleLevels()
+	tiles := newTileSet(makeTiles(s.Width, s.Height, tileSize))
+
+	// Плитки раздаются потокам по мере освобождения, максимум интенсивности обновляется атомарно
+	var maxIntensity uint64
+	if s.checkpoint != nil {
+		maxIntensity = math.Float64bits(s.checkpoint.restore(tiles, field))
+		stopAutosave := s.checkpoint.autosave(tiles, field)
+		defer func() {
+			stopAutosave()
+			s.checkpoint.finish(tiles, field, field.Partial)
+		}()
+	}
+
+	store := func(t tile, r tileResult) {
+		current := math.Float64bits(field.storeTile(t, r))
+		for { // находим максимальную интенсивность для нормализации всех пикселей [0....1]
+			old := atomic.LoadUint64(&maxIntensity)
+			if current <= old || atomic.CompareAndSwapUint64(&maxIntensity, old, current) {
+				break
+			}
+		}
+	}
+
+	var err error
+	if s.remotes != nil {
+		err = s.renderTiles(ctx, tiles, s.remotes.capacity(), func(t tile) bool {
+			return s.remotes.renderTile(ctx, levels, t, store)
+		})
+	} else {
+		err = s.renderTiles(ctx, tiles, s.Workers, func(t tile) bool {
+			store(t, s.computeTile(levels, t))
+			return true
+		})
+	}
+
+	// Нормализация интенсивности
+	maxI := math.Float64frombits(maxIntensity)
+	if maxI == 0 {
+		maxI = 1
+	}
+
+	field.MaxIntensity, field.Partial = maxI, err != nil
+	if field.Partial {
+		return field
+	}
+
+	// Отображение Пуазона с учетом интенсивности и затемнения центра
+	for y := diskCenterY - poissonRadius; y <= diskCenterY+poissonRadius; y++ {
+		for x := diskCenterX - poissonRadius; x <= diskCenterX+poissonRadius; x++ {
+			if x >= 0 && x < s.Width && y >= 0 && y < s.Height && s.skipShadow(x, y, field.Opaque[y][x]) {
+				xPos, yPos := s.screenPosition(x, y, scale)
+				re, im := s.Amplitude(xPos, yPos)
+				intens := re*re + im*im
+
+				// Уменьшаем интенсивность по центру, если много зон
+				field.Intensity[y][x] = intens * fresnelFactor
+				field.Re[y][x], field.Im[y][x] = spotAmplitude(re, im, fresnelFactor)
+			}
+		}
+	}
+
+	return field
+}
@@ -0,0 +1,120 @@
+package diffraction
+
+import (
+	"fmt"
+	"math"
+)
+
+// GeometrySpec — юстировка установки: наклон падающей волны и положение
+// экрана относительно оси препятствия. Углы в радианах, сдвиги в метрах.
+//
+// В параксиальном приближении наклон волны на угол θ сдвигает картину
+// на экране на z·θ, а сдвиг экрана смещает её в обратную сторону.
+// Повёрнутый экран пересекает картины на разных расстояниях от препятствия:
+// кольца вытягиваются, пятно Пуассона смещается и искажается.
+type GeometrySpec struct {
+	TiltX       float64 `json:"tilt_x,omitempty"`        // наклон волны к оси в плоскости xz
+	TiltY       float64 `json:"tilt_y,omitempty"`        // наклон волны к оси в плоскости yz
+	ShiftX      float64 `json:"shift_x,omitempty"`       // сдвиг центра экрана по x
+	ShiftY      float64 `json:"shift_y,omitempty"`       // сдвиг центра экрана по y
+	ScreenTiltX float64 `json:"screen_tilt_x,omitempty"` // поворот экрана вокруг вертикальной оси: край x > 0 дальше от препятствия
+	ScreenTiltY float64 `json:"screen_tilt_y,omitempty"` // поворот экрана вокруг горизонтальной оси: край y > 0 дальше от препятствия
+}
+
+func (g GeometrySpec) validate() error {
+	angles := []struct {
+		name  string
+		value float64
+	}{
+		{"наклон волны", g.TiltX}, {"наклон волны", g.TiltY},
+		{"поворот экрана", g.ScreenTiltX}, {"поворот экрана", g.ScreenTiltY},
+	}
+	for _, a := range angles {
+		if math.IsNaN(a.value) || math.IsInf(a.value, 0) || math.Abs(a.value) >= math.Pi/2 {
+			return fmt.Errorf("%s должен быть меньше π/2 по модулю, получено %v", a.name, a.value)
+		}
+	}
+	for _, shift := range []float64{g.ShiftX, g.ShiftY} {
+		if math.IsNaN(shift) || math.IsInf(shift, 0) {
+			return fmt.Errorf("неверный сдвиг экрана %v", shift)
+		}
+	}
+	return nil
+}
+
+// Aligned сообщает, что волна падает вдоль оси, а экран стоит на оси
+// перпендикулярно ей
+func (g GeometrySpec) Aligned() bool { return g == GeometrySpec{} }
+
+// screenTilted сообщает, что расстояние до экрана меняется от пикселя к пикселю
+func (g GeometrySpec) screenTilted() bool { return g.ScreenTiltX != 0 || g.ScreenTiltY != 0 }
+
+// rotate переводит координаты (u, v) в плоскости экрана в поперечные
+// координаты и прибавку к расстоянию до препятствия
+func (g GeometrySpec) rotate(u, v float64) (x, y, dz float64) {
+	sinA, cosA := math.Sincos(g.ScreenTiltX)
+	sinB, cosB := math.Sincos(g.ScreenTiltY)
+	return u*cosA - v*sinA*sinB, v * cosB, u*sinA + v*cosA*sinB
+}
+
+// unrotate — обратное к rotate: координаты в плоскости экрана точки,
+// которая проецируется вдоль оси в (x, y)
+func (g GeometrySpec) unrotate(x, y float64) (u, v float64) {
+	sinA, cosA := math.Sincos(g.ScreenTiltX)
+	sinB, cosB := math.Sincos(g.ScreenTiltY)
+	v = y / cosB
+	return (x + v*sinA*sinB) / cosA, v
+}
+
+// patternOffset возвращает сдвиг картины относительно центра экрана:
+// наклон волны уводит её на z·θ, сдвиг экрана — в обратную сторону
+func (c *Config) patternOffset() (float64, float64) {
+	return c.Distance*c.Geometry.TiltX - c.Geometry.ShiftX, c.Distance*c.Geometry.TiltY - c.Geometry.ShiftY
+}
+
+// nearestScreenDistance возвращает наименьшее расстояние от препятствия
+// до точек повёрнутого экрана
+func (c *Config) nearestScreenDistance() float64 {
+	halfWidth := c.ScreenWidth / 2
+	halfHeight := c.ScreenWidth * float64(c.Height) / float64(c.Width) / 2
+	_, _, dz := c.Geometry.rotate(halfWidth, halfHeight)
+	_, _, dz2 := c.Geometry.rotate(halfWidth, -halfHeight)
+	return c.Distance - math.Max(math.Abs(dz), math.Abs(dz2))
+}
+
+// screenPoint переводит точку экрана (u, v), м от его центра, в точку
+// картины, которую дала бы волна вдоль оси на неповёрнутом экране
+func (s *Simulation) screenPoint(u, v float64) (float64, float64) {
+	if s.Geometry.screenTilted() {
+		u, v, _ = s.Geometry.rotate(u, v)
+	}
+	return u - s.offsetX, v - s.offsetY
+}
+
+// linePosition возвращает точку картины для столбца x центральной
+// горизонтальной линии экрана и координату столбца от центра экрана
+func (s *Simulation) linePosition(x int, scale float64) (xPos, yPos, u float64) {
+	u = (float64(x) - float64(s.Width)/2) * scale
+	xPos, yPos = s.screenPoint(u, 0)
+	return xPos, yPos, u
+}
+
+// distanceAt возвращает расстояние от препятствия до точки экрана, куда
+// попадает точка картины (x, y). Для экрана, перпендикулярного оси, это
+// Distance; расстояние до наклонённого экрана меняется линейно.
+func (s *Simulation) distanceAt(x, y float64) float64 {
+	if !s.Geometry.screenTilted() {
+		return s.Distance
+	}
+	u, v := s.Geometry.unrotate(x+s.offsetX, y+s.offsetY)
+	_, _, dz := s.Geometry.rotate(u, v)
+	return s.Distance + dz
+}
+
+// SpotPosition возвращает центр тени и пятна Пуассона на экране, м от центра экрана
+func (s *Simulation) SpotPosition() (float64, float64) {
+	if s.Geometry.screenTilted() {
+		return s.Geometry.unrotate(s.offsetX, s.offsetY)
+	}
+	return s.offsetX, s.offsetY
+}
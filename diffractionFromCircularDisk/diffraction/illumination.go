@@ -0,0 +1,124 @@
+package diffraction
+
+import (
+	"fmt"
+	"math"
+)
+
+// IlluminationSpec — волна, падающая на препятствие. Размеры в метрах.
+//
+// В параксиальном приближении все три волны имеют вид exp(ikρ²/(2q))
+// в плоскости препятствия: у плоской волны 1/q = 0, у точечного источника
+// q — расстояние до него, у гауссова пучка q = d - i·zR комплексное
+// (d — расстояние от перетяжки, zR = πw0²/λ — длина Рэлея). Амплитуда
+// на оси в плоскости препятствия равна 1, интенсивность I0 отсчитывается
+// от неё.
+type IlluminationSpec struct {
+	Kind           string  `json:"kind"`                      // plane, point, gaussian
+	SourceDistance float64 `json:"source_distance,omitempty"` // от точечного источника до препятствия
+	Waist          float64 `json:"waist,omitempty"`           // радиус перетяжки гауссова пучка w0
+	WaistDistance  float64 `json:"waist_distance,omitempty"`  // от перетяжки до препятствия; < 0 — пучок сходится к перетяжке за препятствием
+}
+
+func (spec IlluminationSpec) validate() error {
+	finite := func(v float64) bool { return !math.IsNaN(v) && !math.IsInf(v, 0) }
+	switch spec.Kind {
+	case "", "plane":
+	case "point":
+		if !finite(spec.SourceDistance) || spec.SourceDistance <= 0 {
+			return fmt.Errorf("расстояние от источника до препятствия должно быть положительным, получено %v", spec.SourceDistance)
+		}
+	case "gaussian":
+		if !finite(spec.Waist) || spec.Waist <= 0 {
+			return fmt.Errorf("радиус перетяжки пучка должен быть положительным, получено %v", spec.Waist)
+		}
+		if !finite(spec.WaistDistance) {
+			return fmt.Errorf("неверное положение перетяжки %v", spec.WaistDistance)
+		}
+	default:
+		return fmt.Errorf("неизвестное освещение %q (ожидается plane, point или gaussian)", spec.Kind)
+	}
+	return nil
+}
+
+// plane сообщает, падает ли плоская волна
+func (spec IlluminationSpec) plane() bool { return spec.Kind == "" || spec.Kind == "plane" }
+
+// canonical оставляет только параметры выбранной волны. Плоская волна
+// записывается пустым описанием, как в заданиях и контрольных точках,
+// сохранённых до появления освещения.
+func (spec IlluminationSpec) canonical() IlluminationSpec {
+	switch spec.Kind {
+	case "point":
+		return IlluminationSpec{Kind: spec.Kind, SourceDistance: spec.SourceDistance}
+	case "gaussian":
+		return IlluminationSpec{Kind: spec.Kind, Waist: spec.Waist, WaistDistance: spec.WaistDistance}
+	}
+	return IlluminationSpec{}
+}
+
+// curvature возвращает 1/q на длине волны wl
+func (spec IlluminationSpec) curvature(wl float64) complex128 {
+	switch spec.Kind {
+	case "point":
+		return complex(1/spec.SourceDistance, 0)
+	case "gaussian":
+		rayleigh := math.Pi * spec.Waist * spec.Waist / wl
+		return 1 / complex(spec.WaistDistance, -rayleigh)
+	}
+	return 0
+}
+
+// Падающая волна на длине волны wl для экрана на расстоянии z
+type incidentWave struct {
+	plane bool
+	k     float64
+	inv   complex128 // 1/q в плоскости препятствия
+	scale complex128 // 1/M = q/(q+z): волна без препятствия на оси экрана
+}
+
+func (s *Simulation) incidentWave(wl float64) incidentWave {
+	return s.incidentWaveAt(wl, s.Distance)
+}
+
+// incidentWaveAt — то же для экрана на расстоянии z
+func (s *Simulation) incidentWaveAt(wl, z float64) incidentWave {
+	inv := s.Illumination.curvature(wl)
+	return incidentWave{
+		plane: s.Illumination.plane(),
+		k:     2 * math.Pi / wl,
+		inv:   inv,
+		scale: 1 / (1 + complex(z, 0)*inv),
+	}
+}
+
+// exp возвращает exp(ik·r²·c/2) для комплексной кривизны c
+func (w incidentWave) exp(r2 float64, c complex128) (float64, float64) {
+	a := w.k * r2 / 2
+	amp := math.Exp(-a * imag(c))
+	phase := a * real(c)
+	return amp * math.Cos(phase), amp * math.Sin(phase)
+}
+
+// at возвращает падающую волну в точке (x, y) плоскости препятствия
+func (w incidentWave) at(x, y float64) (float64, float64) {
+	return w.exp(x*x+y*y, w.inv)
+}
+
+// geometric возвращает волну без препятствия в точке экрана (x, y) без
+// множителя scale: exp(ik·r²/(2(q+z)))
+func (w incidentWave) geometric(x, y float64) (float64, float64) {
+	return w.exp(x*x+y*y, w.inv*w.scale)
+}
+
+// power возвращает |1/M|² — ослабление интенсивности на оси экрана
+func (w incidentWave) power() float64 {
+	return real(w.scale)*real(w.scale) + imag(w.scale)*imag(w.scale)
+}
+
+// fresnelZonesAt — эффективное число Френеля m = r²/λ·(1/z + Re 1/q):
+// расходящаяся волна открывает больше зон, чем плоская
+func (c *Config) fresnelZonesAt(wl float64) float64 {
+	curvature := 1/c.Distance + real(c.Illumination.curvature(wl))
+	return math.Abs(c.Radius * c.Radius / wl * curvature)
+}
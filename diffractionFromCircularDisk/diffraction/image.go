@@ -0,0 +1,63 @@
+package diffraction
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"gonum.org/v1/plot"
+)
+
+// Image раскрашивает поле в выбранной нормировке
+func (s *Simulation) Image(field *Field) *image.RGBA {
+	return s.RenderImage(field, s.DisplayMax(field.MaxIntensity))
+}
+
+// RenderImage раскрашивает интенсивность, нормированную на maxI.
+// Тень препятствия остаётся чёрной, кроме пятна Пуассона.
+func (s *Simulation) RenderImage(field *Field, maxI float64) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	diskCenterX, diskCenterY := s.shadowCenter(s.ScreenWidth / float64(s.Width))
+
+	// Установка цвета пикселей с нормализованной интенсивностью
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			inSpot := max(abs(x-diskCenterX), abs(y-diskCenterY)) <= poissonRadius
+			if field.Opaque[y][x] && !inSpot {
+				img.Set(x, y, color.RGBA{0, 0, 0, 255})
+				continue
+			}
+			normIntensity := math.Min(field.Intensity[y][x]/maxI, 1)
+			img.Set(x, y, colorFromRingIntensity(normIntensity, x, y, diskCenterX, diskCenterY))
+		}
+	}
+	return img
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func colorFromRingIntensity(intensity float64, x, y, centerX, centerY int) color.RGBA {
+	r := uint8(255 * math.Pow(intensity, 0.6))
+	g := uint8(255 * math.Pow(intensity, 0.9))
+	b := uint8(255 * math.Pow(intensity, 0.4))
+	dx := float64(x - centerX)
+	dy := float64(y - centerY)
+	dist := math.Sqrt(dx*dx + dy*dy)
+
+	// Увеличение синего цвета внутри радиуса
+	if dist < 100 {
+		b = uint8(math.Min(255, float64(b)+150*math.Pow(intensity, 0.8)))
+	}
+
+	return color.RGBA{r, g, b, 255}
+}
+
+// IntensityPlot строит график интенсивности вдоль центральной линии экрана
+func (s *Simulation) IntensityPlot() (*plot.Plot, error) {
+	return s.ProfilePlot(PlotSpec{})
+}
@@ -0,0 +1,330 @@
+package diffraction
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Шаг радиального профиля для поиска колец в долях пикселя
+const metricsOversampling = 4
+
+// Наименьшая глубина экстремума профиля относительно пика пятна: более
+// мелкие колебания считаются шумом Монте-Карло
+const ringProminence = 0.005
+
+// Metrics — характеристики картины. Длины в метрах на экране, координаты —
+// от центра экрана; интенсивности — в единицах расчёта (Normalization).
+// Пятно, кольца и видность измеряются только за препятствием, закрывающим
+// свой центр, как диск: у отверстия или кольца в центре нет тени и пятна
+// Пуассона.
+type Metrics struct {
+	Normalization Normalization `json:"normalization"`
+	FresnelZones  float64       `json:"fresnel_zones"`
+	Occluder      bool          `json:"occluder"`     // препятствие закрывает свой центр
+	Spot          *SpotMetrics  `json:"spot"`         // nil — центр тени вне экрана или препятствие не закрывает центр
+	DarkRings     []Ring        `json:"dark_rings"`   // минимумы вокруг пятна внутри тени
+	BrightRings   []Ring        `json:"bright_rings"` // максимумы вокруг пятна внутри тени
+	Visibility    float64       `json:"visibility"`   // (Imax−Imin)/(Imax+Imin) первого светлого и тёмного колец; 0 — кольца не найдены
+	ShadowEdge    *ShadowEdge   `json:"shadow_edge"`  // nil — тени на экране нет
+	Predicted     *Prediction   `json:"predicted,omitempty"`
+}
+
+// SpotMetrics — пятно Пуассона: самый яркий пиксель около центра тени
+// и ширина радиального профиля на половине высоты
+type SpotMetrics struct {
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Intensity float64 `json:"intensity"`
+	FWHM      float64 `json:"fwhm"` // 0 — спад до половины не найден
+}
+
+// Ring — радиус и интенсивность кольца
+type Ring struct {
+	Radius    float64 `json:"radius"`
+	Intensity float64 `json:"intensity"`
+}
+
+// ShadowEdge — расстояние от центра тени до границы тени на изображении
+type ShadowEdge struct {
+	Radius float64 `json:"radius"` // среднее
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// Prediction — ожидаемые значения для непрозрачного диска. Внутри тени
+// параксиальное решение близко к I(r) = I(0)·J0²(2πN r/a), где
+// N = a²/(λz) — число Френеля диска для плоской волны: тёмные кольца
+// лежат в нулях J0, светлые — в нулях J1. Граница тени — геометрическая
+// тень диска, увеличенная расходящейся волной.
+type Prediction struct {
+	FresnelNumber float64 `json:"fresnel_number"` // N = a²/(λz)
+	SpotIntensity float64 `json:"spot_intensity"`
+	FWHM          float64 `json:"fwhm"`
+	DarkRings     []Ring  `json:"dark_rings"`
+	BrightRings   []Ring  `json:"bright_rings"`
+	Visibility    float64 `json:"visibility"`
+	ShadowEdge    float64 `json:"shadow_edge"`
+}
+
+// besselZeros возвращает первые n положительных нулей f, отделяя их
+// шагом 0.1 и уточняя делением пополам
+func besselZeros(f func(float64) float64, n int) []float64 {
+	var zeros []float64
+	for x := 0.1; len(zeros) < n; x += 0.1 {
+		lo, hi := x, x+0.1
+		if f(lo)*f(hi) > 0 {
+			continue
+		}
+		for range 60 {
+			mid := (lo + hi) / 2
+			if f(lo)*f(mid) <= 0 {
+				hi = mid
+			} else {
+				lo = mid
+			}
+		}
+		zeros = append(zeros, (lo+hi)/2)
+	}
+	return zeros
+}
+
+// Metrics измеряет пятно, кольца и границу тени. Положение пика пятна
+// и граница тени берутся из поля, как их видно на изображении; ширина
+// пятна и кольца — из радиального профиля вокруг центра тени с шагом
+// в четверть пикселя до ближайшей точки границы тени (в поле тень
+// не посчитана). Если тень не шире пикселя, кольца не измеряются.
+func (s *Simulation) Metrics(field *Field, rings int) *Metrics {
+	scale := s.ScreenWidth / float64(s.Width)
+	m := &Metrics{
+		Normalization: s.Normalization,
+		FresnelZones:  s.FresnelZones(),
+		Occluder:      s.obstacle.Opaque(0, 0),
+		DarkRings:     []Ring{},
+		BrightRings:   []Ring{},
+		ShadowEdge:    s.shadowEdge(field, scale),
+	}
+	if !m.Occluder {
+		return m
+	}
+	m.Spot = s.spotPeak(field, scale)
+
+	rMax := s.ScreenWidth / 2
+	if m.ShadowEdge != nil {
+		rMax = m.ShadowEdge.Min
+	}
+	m.Predicted = s.predictMetrics(rings)
+	if rMax <= scale {
+		// Тень уже пикселя: профиль нулевого радиуса означал бы
+		// профиль на полэкрана, а колец внутри тени не разглядеть
+		return m
+	}
+	profile, _ := s.ProfileAlong(context.Background(), ProfileSpec{
+		Kind:   ProfileRadial,
+		Radius: rMax,
+		Points: int(math.Round(rMax/scale*metricsOversampling)) + 1,
+	})
+	fwhm, dark, bright := findRings(profile, rings)
+	if m.Spot != nil {
+		m.Spot.FWHM = fwhm
+	}
+	m.DarkRings = append(m.DarkRings, dark...)
+	m.BrightRings = append(m.BrightRings, bright...)
+	if len(dark) > 0 && len(bright) > 0 && bright[0].Intensity+dark[0].Intensity > 0 {
+		m.Visibility = (bright[0].Intensity - dark[0].Intensity) / (bright[0].Intensity + dark[0].Intensity)
+	}
+	return m
+}
+
+// spotPeak ищет самый яркий пиксель пятна Пуассона около центра тени.
+// Интенсивность в нём считается заново: в нормировке max пятно на
+// изображении дополнительно затемнено множителем зон Френеля.
+func (s *Simulation) spotPeak(field *Field, scale float64) *SpotMetrics {
+	cx, cy := s.shadowCenter(scale)
+	peakX, peakY := -1, -1
+	for y := max(cy-poissonRadius, 0); y <= min(cy+poissonRadius, s.Height-1); y++ {
+		for x := max(cx-poissonRadius, 0); x <= min(cx+poissonRadius, s.Width-1); x++ {
+			if peakX < 0 || field.Intensity[y][x] > field.Intensity[peakY][peakX] {
+				peakX, peakY = x, y
+			}
+		}
+	}
+	if peakX < 0 {
+		return nil
+	}
+	return &SpotMetrics{
+		X:         (float64(peakX) - float64(s.Width)/2) * scale,
+		Y:         (float64(peakY) - float64(s.Height)/2) * scale,
+		Intensity: s.Intensity(s.screenPosition(peakX, peakY, scale)),
+	}
+}
+
+// shadowEdge измеряет расстояния от центра тени до пикселей тени, у которых
+// дальше от центра есть освещённый сосед. Освещённые пиксели пятна
+// Пуассона внутри тени границей не считаются.
+func (s *Simulation) shadowEdge(field *Field, scale float64) *ShadowEdge {
+	u0, v0 := s.SpotPosition()
+	radius := func(x, y int) float64 {
+		return math.Hypot((float64(x)-float64(s.Width)/2)*scale-u0, (float64(y)-float64(s.Height)/2)*scale-v0)
+	}
+	var edge *ShadowEdge
+	var sum float64
+	count := 0
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			if !field.Opaque[y][x] {
+				continue
+			}
+			r := radius(x, y)
+			boundary := false
+			for _, d := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				nx, ny := x+d[0], y+d[1]
+				if nx >= 0 && nx < s.Width && ny >= 0 && ny < s.Height && !field.Opaque[ny][nx] && radius(nx, ny) > r {
+					boundary = true
+				}
+			}
+			if !boundary {
+				continue
+			}
+			if edge == nil {
+				edge = &ShadowEdge{Min: r, Max: r}
+			}
+			edge.Min, edge.Max = math.Min(edge.Min, r), math.Max(edge.Max, r)
+			sum += r
+			count++
+		}
+	}
+	if edge != nil {
+		edge.Radius = sum / float64(count)
+	}
+	return edge
+}
+
+// findRings находит по радиальному профилю ширину центрального пика на
+// половине высоты и первые n тёмных и светлых колец. Экстремум засчитывается,
+// когда профиль отходит от него больше чем на ringProminence от пика;
+// положение уточняется по параболе через соседние отсчёты.
+func findRings(profile []ProfilePoint, n int) (fwhm float64, dark, bright []Ring) {
+	peak := profile[0].Intensity
+	for i := 1; i < len(profile); i++ {
+		if profile[i].Intensity < peak/2 {
+			a, b := profile[i-1], profile[i]
+			fwhm = 2 * (a.X + (a.Intensity-peak/2)/(a.Intensity-b.Intensity)*(b.X-a.X))
+			break
+		}
+	}
+
+	delta := ringProminence * peak
+	extremum := func(i int) Ring {
+		if i == 0 || i == len(profile)-1 {
+			return Ring{Radius: profile[i].X, Intensity: profile[i].Intensity}
+		}
+		a, b, c := profile[i-1].Intensity, profile[i].Intensity, profile[i+1].Intensity
+		denom := a - 2*b + c
+		if denom == 0 {
+			return Ring{Radius: profile[i].X, Intensity: b}
+		}
+		t := (a - c) / (2 * denom)
+		step := profile[i+1].X - profile[i].X
+		return Ring{Radius: profile[i].X + t*step, Intensity: math.Max(0, b-(a-c)*t/4)}
+	}
+
+	lookingForMin := true
+	low, high := 0, 0
+	for i, p := range profile {
+		if len(dark) >= n && len(bright) >= n {
+			break
+		}
+		if p.Intensity > profile[high].Intensity {
+			high = i
+		}
+		if p.Intensity < profile[low].Intensity {
+			low = i
+		}
+		switch {
+		case lookingForMin && p.Intensity > profile[low].Intensity+delta:
+			dark = append(dark, extremum(low))
+			high, lookingForMin = i, false
+		case !lookingForMin && p.Intensity < profile[high].Intensity-delta:
+			bright = append(bright, extremum(high))
+			low, lookingForMin = i, true
+		}
+	}
+	return fwhm, dark[:min(n, len(dark))], bright[:min(n, len(bright))]
+}
+
+// predictMetrics считает ожидаемые значения для диска; для остальных
+// препятствий и повёрнутого экрана предсказания нет
+func (s *Simulation) predictMetrics(rings int) *Prediction {
+	if _, ok := s.obstacle.(Disk); !ok || s.Geometry.screenTilted() {
+		return nil
+	}
+	theory, ok := s.axisTheory()
+	if !ok {
+		return nil
+	}
+	spot := theory * math.Pow(s.fresnelFactorAt(s.Wavelength), 2)
+	n := s.Radius * s.Radius / (s.Wavelength * s.Distance)
+	// Радиус на экране, где аргумент J0 равен x
+	radius := func(x float64) float64 { return x * s.Radius / (2 * math.Pi * n) }
+	halfMax := besselZeros(func(x float64) float64 { return math.J0(x)*math.J0(x) - 0.5 }, 1)[0]
+	wave := s.incidentWave(s.Wavelength)
+
+	p := &Prediction{
+		FresnelNumber: n,
+		SpotIntensity: spot,
+		FWHM:          2 * radius(halfMax),
+		DarkRings:     []Ring{},
+		BrightRings:   []Ring{},
+		Visibility:    1,
+		ShadowEdge:    s.Radius * (1 + s.Distance*real(wave.inv)),
+	}
+	for _, x := range besselZeros(math.J0, rings) {
+		p.DarkRings = append(p.DarkRings, Ring{Radius: radius(x)})
+	}
+	for _, x := range besselZeros(math.J1, rings) {
+		p.BrightRings = append(p.BrightRings, Ring{Radius: radius(x), Intensity: spot * math.J0(x) * math.J0(x)})
+	}
+	return p
+}
+
+// Report пишет краткую сводку: пятно, первые кольца и границу тени
+func (m *Metrics) Report(w io.Writer) {
+	um := func(v float64) float64 { return v * 1e6 }
+	if !m.Occluder {
+		fmt.Fprintln(w, "Препятствие не закрывает свой центр, пятно Пуассона и кольца не измеряются")
+	} else if m.Spot != nil {
+		fmt.Fprintf(w, "Пятно Пуассона: (%.2f, %.2f) мкм, интенсивность %.6f, ширина на полувысоте %.2f мкм", um(m.Spot.X), um(m.Spot.Y), m.Spot.Intensity, um(m.Spot.FWHM))
+		if m.Predicted != nil {
+			fmt.Fprintf(w, " (теория %.6f, %.2f мкм)", m.Predicted.SpotIntensity, um(m.Predicted.FWHM))
+		}
+		fmt.Fprintln(w)
+	} else {
+		fmt.Fprintln(w, "Центр тени вне экрана, пятно Пуассона не измерено")
+	}
+	for i, r := range m.DarkRings {
+		fmt.Fprintf(w, "Тёмное кольцо %d: радиус %.2f мкм", i+1, um(r.Radius))
+		if m.Predicted != nil && i < len(m.Predicted.DarkRings) {
+			fmt.Fprintf(w, " (теория %.2f мкм)", um(m.Predicted.DarkRings[i].Radius))
+		}
+		fmt.Fprintln(w)
+	}
+	for i, r := range m.BrightRings {
+		fmt.Fprintf(w, "Светлое кольцо %d: радиус %.2f мкм, интенсивность %.6f", i+1, um(r.Radius), r.Intensity)
+		if m.Predicted != nil && i < len(m.Predicted.BrightRings) {
+			fmt.Fprintf(w, " (теория %.2f мкм, %.6f)", um(m.Predicted.BrightRings[i].Radius), m.Predicted.BrightRings[i].Intensity)
+		}
+		fmt.Fprintln(w)
+	}
+	if m.Occluder {
+		fmt.Fprintf(w, "Видность колец: %.3f\n", m.Visibility)
+	}
+	if m.ShadowEdge != nil {
+		fmt.Fprintf(w, "Граница тени: %.2f мкм от центра (от %.2f до %.2f)", um(m.ShadowEdge.Radius), um(m.ShadowEdge.Min), um(m.ShadowEdge.Max))
+		if m.Predicted != nil {
+			fmt.Fprintf(w, ", теория %.2f мкм", um(m.Predicted.ShadowEdge))
+		}
+		fmt.Fprintln(w)
+	}
+}
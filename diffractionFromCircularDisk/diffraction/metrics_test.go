@@ -0,0 +1,119 @@
+package diffraction
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// profileOf возвращает профиль f на [0, rMax] с шагом step
+func profileOf(f func(r float64) float64, rMax, step float64) []ProfilePoint {
+	var profile []ProfilePoint
+	for r := 0.0; r <= rMax; r += step {
+		profile = append(profile, ProfilePoint{X: r, Intensity: f(r)})
+	}
+	return profile
+}
+
+func TestFindRings(t *testing.T) {
+	j0 := func(r float64) float64 { return math.J0(r) * math.J0(r) }
+	halfMax := besselZeros(func(x float64) float64 { return j0(x) - 0.5 }, 1)[0]
+	cases := []struct {
+		name         string
+		profile      []ProfilePoint
+		n            int
+		fwhm         float64
+		dark, bright []float64
+		tol          float64 // допустимое смещение колец
+	}{
+		{"J0²", profileOf(j0, 12, 0.01), 3, 2 * halfMax, besselZeros(math.J0, 3), besselZeros(math.J1, 3), 0.01},
+		// Шум сдвигает плоские минимумы, но не добавляет колец
+		{"шум мельче порога", profileOf(func(r float64) float64 { return j0(r) + 0.001*math.Sin(40*r) }, 12, 0.01), 2,
+			2 * halfMax, besselZeros(math.J0, 2), besselZeros(math.J1, 2), 0.1},
+		{"колец меньше, чем запрошено", profileOf(j0, 6, 0.01), 3, 2 * halfMax, besselZeros(math.J0, 2), besselZeros(math.J1, 1), 0.01},
+		{"монотонный спад", profileOf(func(r float64) float64 { return math.Exp(-r) }, 5, 0.01), 3, 2 * math.Ln2, nil, nil, 0},
+		{"без спада до половины", profileOf(func(r float64) float64 { return 1 - 0.1*r }, 1, 0.01), 3, 0, nil, nil, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fwhm, dark, bright := findRings(tc.profile, tc.n)
+			if math.Abs(fwhm-tc.fwhm) > 0.02 {
+				t.Errorf("ширина на полувысоте %.4f, ожидается %.4f", fwhm, tc.fwhm)
+			}
+			check := func(kind string, got []Ring, want []float64) {
+				if len(got) != len(want) {
+					t.Fatalf("%s колец: %d, ожидается %d", kind, len(got), len(want))
+				}
+				for i, r := range got {
+					if math.Abs(r.Radius-want[i]) > tc.tol {
+						t.Errorf("%s кольцо %d: радиус %.4f, ожидается %.4f", kind, i+1, r.Radius, want[i])
+					}
+				}
+			}
+			check("тёмных", dark, tc.dark)
+			check("светлых", bright, tc.bright)
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     []Option
+		occluder bool
+		rings    bool // кольца измеряются и совпадают с предсказанием
+	}{
+		{"диск", nil, true, true},
+		{"отверстие", []Option{WithObstacle(ObstacleSpec{Kind: "aperture"})}, false, false},
+		{"тень не шире пикселя", []Option{WithRadius(4e-6), WithDistance(2e-5)}, true, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := testSimulation(t, append([]Option{
+				WithSize(128, 128),
+				WithSamples(20000, SamplingUniform),
+				WithNormalization(NormalizePhysical),
+			}, tc.opts...)...)
+			scale := sim.ScreenWidth / float64(sim.Width)
+			m := sim.Metrics(sim.Field(context.Background()), 2)
+			if m.Occluder != tc.occluder {
+				t.Fatalf("occluder = %v, ожидается %v", m.Occluder, tc.occluder)
+			}
+			if !tc.occluder {
+				if m.Spot != nil || m.Predicted != nil || len(m.DarkRings) > 0 {
+					t.Errorf("за отверстием измерены пятно или кольца")
+				}
+				return
+			}
+			if m.Spot == nil || m.Predicted == nil {
+				t.Fatalf("нет пятна или предсказания для диска")
+			}
+			if !tc.rings {
+				if len(m.DarkRings) > 0 || len(m.BrightRings) > 0 || m.Spot.FWHM != 0 {
+					t.Errorf("кольца измерены в тени не шире пикселя: %+v", m)
+				}
+				return
+			}
+			if math.Abs(m.Spot.Intensity-m.Predicted.SpotIntensity) > 0.01 {
+				t.Errorf("интенсивность пятна %.4f, теория %.4f", m.Spot.Intensity, m.Predicted.SpotIntensity)
+			}
+			if math.Abs(m.Spot.FWHM-m.Predicted.FWHM) > scale {
+				t.Errorf("ширина пятна %.3g м, теория %.3g м", m.Spot.FWHM, m.Predicted.FWHM)
+			}
+			if len(m.DarkRings) != 2 || len(m.BrightRings) != 2 {
+				t.Fatalf("найдено %d тёмных и %d светлых колец, ожидается по 2", len(m.DarkRings), len(m.BrightRings))
+			}
+			for i := range 2 {
+				if d := math.Abs(m.DarkRings[i].Radius - m.Predicted.DarkRings[i].Radius); d > scale {
+					t.Errorf("тёмное кольцо %d отстоит от предсказания на %.3g м", i+1, d)
+				}
+				if d := math.Abs(m.BrightRings[i].Radius - m.Predicted.BrightRings[i].Radius); d > scale {
+					t.Errorf("светлое кольцо %d отстоит от предсказания на %.3g м", i+1, d)
+				}
+			}
+			if m.ShadowEdge == nil || math.Abs(m.ShadowEdge.Radius-m.Predicted.ShadowEdge) > 2*scale {
+				t.Errorf("граница тени %+v, теория %.3g м", m.ShadowEdge, m.Predicted.ShadowEdge)
+			}
+		})
+	}
+}
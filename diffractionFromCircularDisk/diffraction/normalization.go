@@ -0,0 +1,89 @@
+package diffraction
+
+import "fmt"
+
+// Normalization — нормировка интенсивности
+type Normalization string
+
+const (
+	// Амплитуда умножается на множитель зон Френеля, яркость изображения
+	// нормируется на самый яркий пиксель
+	NormalizeMax Normalization = "max"
+	// Интенсивность в единицах I/I0 — относительно волны без препятствия,
+	// без множителя зон Френеля; изображения разных запусков сравнимы
+	NormalizePhysical Normalization = "physical"
+)
+
+// Интенсивность I/I0, которой соответствует белый цвет в физической
+// нормировке; более яркие пиксели насыщаются
+const physicalDisplayMax = 2.0
+
+func ParseNormalization(s string) (Normalization, error) {
+	switch m := Normalization(s); m {
+	case NormalizeMax, NormalizePhysical:
+		return m, nil
+	}
+	return "", fmt.Errorf("неизвестная нормировка %q (ожидается max или physical)", s)
+}
+
+// DisplayMax возвращает интенсивность, которой соответствует белый цвет:
+// в физической нормировке шкала общая для всех запусков, иначе — maxI
+func (s *Simulation) DisplayMax(maxI float64) float64 {
+	if s.Normalization == NormalizePhysical {
+		return physicalDisplayMax
+	}
+	return maxI
+}
+
+// PrintCenterIntensity выводит интенсивность в центре экрана. В физической
+// нормировке для диска она сравнивается с теорией (axisTheory): на оси за
+// диском в параксиальном приближении I = I0 (пятно Араго — Пуассона). При
+// нарушенной юстировке интенсивность берётся в центре тени, а не экрана.
+func (s *Simulation) PrintCenterIntensity() {
+	center := s.Intensity(0, 0)
+	where := "в центре экрана"
+	if !s.Geometry.Aligned() {
+		where = "в центре тени"
+	}
+	if s.Normalization != NormalizePhysical {
+		s.logf("Интенсивность %s: %.6f\n", where, center)
+		return
+	}
+	s.logf("Интенсивность %s: I/I0 = %.6f\n", where, center)
+	theory, ok := s.axisTheory()
+	switch {
+	case !ok:
+	case s.contributions != nil:
+		// Протяжённый источник и ширина спектра размывают пятно
+		s.logf("Теория для диска с учётом частичной когерентности: I/I0 = %.6f на оси, отличие %.2f%%\n", theory, 100*(center/theory-1))
+	case s.Illumination.plane():
+		s.logf("Теория для диска: I/I0 = 1 на оси, отличие %.2f%%\n", 100*(center-1))
+	default:
+		s.logf("Теория для диска: I/I0 = %.6f на оси, отличие %.2f%%\n", theory, 100*(center/theory-1))
+	}
+}
+
+// axisTheory возвращает теоретическую интенсивность I/I0 на оси за диском.
+// Для плоской волны это 1, для неплоской — интенсивность, падающая на край
+// диска, ослабленная в M² раз расхождением волны до экрана; при частичной
+// когерентности — аналитическое решение, усреднённое по вкладам. Для
+// остальных препятствий ok = false.
+func (s *Simulation) axisTheory() (theory float64, ok bool) {
+	d, ok := s.obstacle.(Disk)
+	if !ok {
+		return 0, false
+	}
+	if s.contributions != nil {
+		exact, ok := s.referenceIntensity()
+		if !ok {
+			return 0, false
+		}
+		return exact(0, 0), true
+	}
+	if s.Illumination.plane() {
+		return 1, true
+	}
+	wave := s.incidentWaveAt(s.Wavelength, s.distanceAt(0, 0))
+	re, im := wave.at(d.R, 0)
+	return (re*re + im*im) * wave.power(), true
+}
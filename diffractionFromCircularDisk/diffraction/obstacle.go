@@ -0,0 +1,359 @@
+package diffraction
+
+import (
+	"fmt"
+	"image"
+	_ "image/png"
+	"math"
+	"os"
+	"strings"
+)
+
+// Obstacle описывает препятствие или отверстие в плоскости z = 0.
+// Амплитуда на экране считается как Bias плюс взвешенная сумма вкладов
+// точек контуров, каждый контур входит со своим знаком.
+type Obstacle interface {
+	Opaque(x, y float64) bool // точка находится в геометрической тени
+	Contours() []Contour
+	Bias() float64 // амплитуда, не зависящая от краёв (1 для дополнений)
+}
+
+// Contour — замкнутый край, параметризованный нормированной длиной дуги t ∈ [0, 1).
+// Непрозрачная часть обходится против часовой стрелки.
+type Contour struct {
+	Sign    float64
+	Length  float64
+	At      func(t float64) (float64, float64)
+	Tangent func(t float64) (float64, float64) // производная At по t; nil, если направление края неизвестно
+}
+
+// Disk — непрозрачный круглый диск
+type Disk struct{ R float64 }
+
+func (d Disk) Opaque(x, y float64) bool { return x*x+y*y < d.R*d.R }
+func (d Disk) Bias() float64            { return 0 }
+func (d Disk) Contours() []Contour {
+	return []Contour{circleContour(d.R, 1)}
+}
+
+// Annulus — непрозрачное кольцо между радиусами Inner и Outer
+type Annulus struct{ Inner, Outer float64 }
+
+func (a Annulus) Opaque(x, y float64) bool {
+	r2 := x*x + y*y
+	return r2 < a.Outer*a.Outer && r2 >= a.Inner*a.Inner
+}
+func (a Annulus) Bias() float64 { return 1 }
+func (a Annulus) Contours() []Contour {
+	// По линейности: свободная волна минус отверстие Outer плюс отверстие Inner
+	return []Contour{circleContour(a.Outer, 1), circleContour(a.Inner, -1)}
+}
+
+// Rectangle — непрозрачный прямоугольник с центром в начале координат
+type Rectangle struct{ Width, Height float64 }
+
+func (r Rectangle) Opaque(x, y float64) bool {
+	return math.Abs(x) < r.Width/2 && math.Abs(y) < r.Height/2
+}
+func (r Rectangle) Bias() float64 { return 0 }
+func (r Rectangle) Contours() []Contour {
+	w, h := r.Width/2, r.Height/2
+	return []Contour{polylineContour([][2]float64{{w, h}, {-w, h}, {-w, -h}, {w, -h}}, 1)}
+}
+
+// Polygon — непрозрачный правильный многоугольник с радиусом описанной окружности R
+type Polygon struct {
+	Sides int
+	R     float64
+	v     [][2]float64 // вершины, построенные в BuildObstacle; nil — строятся при каждом вызове
+}
+
+func (p Polygon) vertices() [][2]float64 {
+	if p.v != nil {
+		return p.v
+	}
+	v := make([][2]float64, p.Sides)
+	for i := range v {
+		theta := 2*math.Pi*float64(i)/float64(p.Sides) + math.Pi/2
+		v[i] = [2]float64{p.R * math.Cos(theta), p.R * math.Sin(theta)}
+	}
+	return v
+}
+
+func (p Polygon) Opaque(x, y float64) bool {
+	// Точка внутри выпуклого многоугольника лежит слева от всех рёбер
+	v := p.vertices()
+	for i := range v {
+		a, b := v[i], v[(i+1)%len(v)]
+		if (b[0]-a[0])*(y-a[1])-(b[1]-a[1])*(x-a[0]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+func (p Polygon) Bias() float64 { return 0 }
+func (p Polygon) Contours() []Contour {
+	return []Contour{polylineContour(p.vertices(), 1)}
+}
+
+// Mask — произвольное препятствие из PNG: тёмные пиксели непрозрачны.
+// Изображение растягивается по ширине на Width и центрируется.
+type Mask struct {
+	Width  float64
+	opaque [][]bool
+	edge   [][2]float64
+}
+
+// loadMask читает PNG и находит пиксели края — непрозрачные пиксели,
+// у которых есть прозрачный сосед или которые лежат на границе изображения
+func loadMask(filename string, width float64) (*Mask, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать маску %s: %w", filename, err)
+	}
+
+	b := src.Bounds()
+	m := &Mask{Width: width, opaque: make([][]bool, b.Dy())}
+	for y := range m.opaque {
+		m.opaque[y] = make([]bool, b.Dx())
+		for x := range m.opaque[y] {
+			r, g, bl, _ := src.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			m.opaque[y][x] = 0.299*float64(r)+0.587*float64(g)+0.114*float64(bl) < 0.5*0xffff
+		}
+	}
+
+	for y := range m.opaque {
+		for x := range m.opaque[y] {
+			if m.opaque[y][x] && !(m.opaqueAt(x-1, y) && m.opaqueAt(x+1, y) && m.opaqueAt(x, y-1) && m.opaqueAt(x, y+1)) {
+				m.edge = append(m.edge, m.position(x, y))
+			}
+		}
+	}
+	if len(m.edge) == 0 {
+		return nil, fmt.Errorf("маска %s не содержит непрозрачных пикселей", filename)
+	}
+	return m, nil
+}
+
+func (m *Mask) opaqueAt(x, y int) bool {
+	return y >= 0 && y < len(m.opaque) && x >= 0 && x < len(m.opaque[y]) && m.opaque[y][x]
+}
+
+// pixelSize — размер пикселя маски в метрах
+func (m *Mask) pixelSize() float64 { return m.Width / float64(len(m.opaque[0])) }
+
+func (m *Mask) position(x, y int) [2]float64 {
+	s := m.pixelSize()
+	return [2]float64{
+		(float64(x) + 0.5 - float64(len(m.opaque[0]))/2) * s,
+		(float64(y) + 0.5 - float64(len(m.opaque))/2) * s,
+	}
+}
+
+func (m *Mask) Opaque(x, y float64) bool {
+	s := m.pixelSize()
+	px := int(math.Floor(x/s + float64(len(m.opaque[0]))/2))
+	py := int(math.Floor(y/s + float64(len(m.opaque))/2))
+	return m.opaqueAt(px, py)
+}
+func (m *Mask) Bias() float64 { return 0 }
+func (m *Mask) Contours() []Contour {
+	return []Contour{{
+		Sign:   1,
+		Length: float64(len(m.edge)) * m.pixelSize(),
+		At: func(t float64) (float64, float64) {
+			p := m.edge[min(int(t*float64(len(m.edge))), len(m.edge)-1)]
+			return p[0], p[1]
+		},
+	}}
+}
+
+// Complement — дополнение по Бабине: прозрачное и непрозрачное меняются местами,
+// амплитуда равна свободной волне минус амплитуда исходного препятствия
+type Complement struct{ Of Obstacle }
+
+func (c Complement) Opaque(x, y float64) bool { return !c.Of.Opaque(x, y) }
+func (c Complement) Bias() float64            { return 1 - c.Of.Bias() }
+func (c Complement) Contours() []Contour {
+	contours := c.Of.Contours()
+	for i := range contours {
+		contours[i].Sign = -contours[i].Sign
+	}
+	return contours
+}
+
+func circleContour(r, sign float64) Contour {
+	return Contour{
+		Sign:   sign,
+		Length: 2 * math.Pi * r,
+		At: func(t float64) (float64, float64) {
+			theta := t * 2 * math.Pi
+			return r * math.Cos(theta), r * math.Sin(theta)
+		},
+		Tangent: func(t float64) (float64, float64) {
+			theta := t * 2 * math.Pi
+			return -2 * math.Pi * r * math.Sin(theta), 2 * math.Pi * r * math.Cos(theta)
+		},
+	}
+}
+
+// polylineContour строит замкнутую ломаную с параметризацией по длине дуги
+func polylineContour(v [][2]float64, sign float64) Contour {
+	cum := make([]float64, len(v)+1)
+	for i := range v {
+		a, b := v[i], v[(i+1)%len(v)]
+		cum[i+1] = cum[i] + math.Hypot(b[0]-a[0], b[1]-a[1])
+	}
+	total := cum[len(v)]
+	// side возвращает сторону, на которую приходится длина дуги s
+	side := func(s float64) int {
+		i := 0
+		for i < len(v)-1 && cum[i+1] <= s {
+			i++
+		}
+		return i
+	}
+	return Contour{
+		Sign:   sign,
+		Length: total,
+		At: func(t float64) (float64, float64) {
+			s := t * total
+			i := side(s)
+			a, b := v[i], v[(i+1)%len(v)]
+			f := (s - cum[i]) / (cum[i+1] - cum[i])
+			return a[0] + f*(b[0]-a[0]), a[1] + f*(b[1]-a[1])
+		},
+		Tangent: func(t float64) (float64, float64) {
+			i := side(t * total)
+			a, b := v[i], v[(i+1)%len(v)]
+			f := total / (cum[i+1] - cum[i])
+			return f * (b[0] - a[0]), f * (b[1] - a[1])
+		},
+	}
+}
+
+// generateEdgePoints распределяет n точек по контурам пропорционально их
+// длине. Вес точки включает знак контура, сумма модулей весов контура равна 1.
+func generateEdgePoints(o Obstacle, n int, method SamplingMethod, seed int64, workers int) []Point {
+	contours := o.Contours()
+	points := make([]Point, 0, n)
+	for i, count := range contourSampleCounts(contours, n) {
+		c := contours[i]
+		// Каждый контур получает свою последовательность случайных чисел;
+		// номера контуров не пересекаются с номерами уровней sampleLevels
+		t, w := sampleParameters(count, method, streamSeed(seed, int64(i)<<32), workers)
+		for j := range t {
+			x, y := c.At(t[j])
+			p := Point{X: x, Y: y, W: c.Sign * w[j]}
+			if c.Tangent != nil {
+				p.TX, p.TY = c.Tangent(t[j])
+			}
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// contourSampleCounts делит n точек между контурами пропорционально длине,
+// каждому контуру достаётся хотя бы одна точка
+func contourSampleCounts(contours []Contour, n int) []int {
+	var total float64
+	for _, c := range contours {
+		total += c.Length
+	}
+
+	counts := make([]int, len(contours))
+	left := n
+	for i, c := range contours {
+		count := left
+		if i < len(contours)-1 {
+			count = max(1, int(math.Round(float64(n)*c.Length/total)))
+			count = min(count, left)
+		}
+		counts[i] = count
+		left -= count
+	}
+	return counts
+}
+
+// Описание препятствия, из которого строится Obstacle. Размеры в метрах.
+type ObstacleSpec struct {
+	Kind        string  `json:"kind"`                   // disk, aperture, annulus, rect, polygon, mask; префикс ~ — дополнение
+	Complement  bool    `json:"complement,omitempty"`   // дополнение по Бабине
+	InnerRadius float64 `json:"inner_radius,omitempty"` // внутренний радиус кольца
+	Height      float64 `json:"height,omitempty"`       // высота прямоугольника
+	Sides       int     `json:"sides,omitempty"`        // число сторон многоугольника
+	MaskPath    string  `json:"mask,omitempty"`         // путь к PNG-маске
+}
+
+// ParseObstacleKind разбирает название препятствия; префикс ~ означает дополнение
+func ParseObstacleKind(s string) (ObstacleSpec, error) {
+	spec := ObstacleSpec{Kind: strings.TrimPrefix(s, "~"), Complement: strings.HasPrefix(s, "~")}
+	switch spec.Kind {
+	case "disk", "aperture", "annulus", "rect", "polygon", "mask":
+		return spec, nil
+	}
+	return spec, fmt.Errorf("неизвестное препятствие %q (ожидается disk, aperture, annulus, rect, polygon или mask)", s)
+}
+
+// normalized переносит префикс ~ из названия в флаг дополнения, чтобы
+// одинаковые препятствия описывались одинаково
+func (spec ObstacleSpec) normalized() (ObstacleSpec, error) {
+	kind, err := ParseObstacleKind(spec.Kind)
+	if err != nil {
+		return spec, err
+	}
+	spec.Kind = kind.Kind
+	spec.Complement = spec.Complement || kind.Complement
+	return spec, nil
+}
+
+// BuildObstacle создаёт препятствие; radius задаёт его основной размер
+func BuildObstacle(spec ObstacleSpec, radius float64) (Obstacle, error) {
+	spec, err := spec.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	var o Obstacle
+	switch spec.Kind {
+	case "disk":
+		o = Disk{R: radius}
+	case "aperture":
+		o = Complement{Of: Disk{R: radius}}
+	case "annulus":
+		if spec.InnerRadius <= 0 || spec.InnerRadius >= radius {
+			return nil, fmt.Errorf("внутренний радиус кольца должен быть в интервале (0, %g)", radius)
+		}
+		o = Annulus{Inner: spec.InnerRadius, Outer: radius}
+	case "rect":
+		if spec.Height <= 0 {
+			return nil, fmt.Errorf("высота прямоугольника должна быть положительной")
+		}
+		o = Rectangle{Width: 2 * radius, Height: spec.Height}
+	case "polygon":
+		if spec.Sides < 3 {
+			return nil, fmt.Errorf("у многоугольника должно быть не меньше 3 сторон")
+		}
+		p := Polygon{Sides: spec.Sides, R: radius}
+		p.v = p.vertices() // Opaque вызывается для каждого пикселя
+		o = p
+	case "mask":
+		m, err := loadMask(spec.MaskPath, 2*radius)
+		if err != nil {
+			return nil, err
+		}
+		o = m
+	}
+
+	if spec.Complement {
+		o = Complement{Of: o}
+	}
+	return o, nil
+}
@@ -0,0 +1,74 @@
+package diffraction
+
+import "testing"
+
+func TestBuildObstacle(t *testing.T) {
+	const r = 1.0
+	type point struct {
+		x, y   float64
+		opaque bool
+	}
+	cases := []struct {
+		spec     ObstacleSpec
+		bias     float64
+		contours int
+		points   []point
+	}{
+		{ObstacleSpec{Kind: "disk"}, 0, 1, []point{{0, 0, true}, {0.99, 0, true}, {1.01, 0, false}, {0.8, 0.8, false}}},
+		{ObstacleSpec{Kind: "aperture"}, 1, 1, []point{{0, 0, false}, {1.01, 0, true}}},
+		{ObstacleSpec{Kind: "~disk"}, 1, 1, []point{{0, 0, false}, {1.01, 0, true}}},
+		{ObstacleSpec{Kind: "annulus", InnerRadius: 0.5}, 1, 2, []point{{0, 0, false}, {0.7, 0, true}, {1.01, 0, false}}},
+		{ObstacleSpec{Kind: "rect", Height: 0.5}, 0, 1, []point{{0, 0, true}, {0.9, 0.2, true}, {0, 0.3, false}}},
+		// Вершина правильного шестиугольника лежит на оси y, середина стороны — на оси x на расстоянии R·cos 30°
+		{ObstacleSpec{Kind: "polygon", Sides: 6}, 0, 1, []point{{0, 0, true}, {0, 0.99, true}, {0.85, 0, true}, {0.88, 0, false}}},
+		{ObstacleSpec{Kind: "polygon", Sides: 6, Complement: true}, 1, 1, []point{{0, 0, false}, {0.88, 0, true}}},
+	}
+	for _, tc := range cases {
+		o, err := BuildObstacle(tc.spec, r)
+		if err != nil {
+			t.Errorf("%+v: неожиданная ошибка %v", tc.spec, err)
+			continue
+		}
+		if o.Bias() != tc.bias {
+			t.Errorf("%+v: Bias = %g, ожидается %g", tc.spec, o.Bias(), tc.bias)
+		}
+		if n := len(o.Contours()); n != tc.contours {
+			t.Errorf("%+v: %d контуров, ожидается %d", tc.spec, n, tc.contours)
+		}
+		for _, p := range tc.points {
+			if got := o.Opaque(p.x, p.y); got != p.opaque {
+				t.Errorf("%+v: Opaque(%g, %g) = %v, ожидается %v", tc.spec, p.x, p.y, got, p.opaque)
+			}
+		}
+	}
+}
+
+func TestBuildObstacleErrors(t *testing.T) {
+	for _, spec := range []ObstacleSpec{
+		{Kind: "ellipse"},
+		{Kind: "polygon", Sides: 2},
+		{Kind: "annulus", InnerRadius: 1},
+		{Kind: "annulus"},
+		{Kind: "rect"},
+		{Kind: "mask", MaskPath: "несуществующий.png"},
+	} {
+		if _, err := BuildObstacle(spec, 1); err == nil {
+			t.Errorf("%+v: ожидалась ошибка", spec)
+		}
+	}
+}
+
+// Контур диска параметризован длиной дуги и лежит на окружности
+func TestDiskContour(t *testing.T) {
+	o, err := BuildObstacle(ObstacleSpec{Kind: "disk"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := o.Contours()[0]
+	for _, tt := range []float64{0, 0.25, 0.5, 0.9} {
+		x, y := c.At(tt)
+		if d := x*x + y*y - 4; d > 1e-12 || d < -1e-12 {
+			t.Errorf("точка контура t = %g: (%g, %g) не лежит на окружности радиуса 2", tt, x, y)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package diffraction
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+)
+
+// PhaseImages рисует карту фазы arg(A) в циклической палитре и
+// доменную раскраску, где оттенок — фаза, а яркость — модуль амплитуды.
+// Фаза отсчитывается от фазы падающей плоской волны. Тень препятствия
+// остаётся чёрной, кроме пятна Пуассона, как в RenderImage. Поле должно
+// быть когерентным: у частично когерентного поля Re и Im равны nil.
+func (s *Simulation) PhaseImages(field *Field) (phaseImg, domainImg *image.RGBA) {
+	phaseImg = image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	domainImg = image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	diskCenterX, diskCenterY := s.shadowCenter(s.ScreenWidth / float64(s.Width))
+
+	var maxAmp float64
+	for y := range field.Re {
+		for x := range field.Re[y] {
+			if !field.Opaque[y][x] {
+				maxAmp = math.Max(maxAmp, math.Hypot(field.Re[y][x], field.Im[y][x]))
+			}
+		}
+	}
+	if maxAmp == 0 {
+		maxAmp = 1
+	}
+
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			inSpot := max(abs(x-diskCenterX), abs(y-diskCenterY)) <= poissonRadius
+			if field.Opaque[y][x] && !inSpot {
+				phaseImg.Set(x, y, color.RGBA{0, 0, 0, 255})
+				domainImg.Set(x, y, color.RGBA{0, 0, 0, 255})
+				continue
+			}
+			re, im := field.Re[y][x], field.Im[y][x]
+			phase := math.Atan2(im, re)
+			phaseImg.Set(x, y, cyclicColor(phase))
+			domainImg.Set(x, y, hsvColor(phase/(2*math.Pi), 1, math.Hypot(re, im)/maxAmp))
+		}
+	}
+
+	return phaseImg, domainImg
+}
+
+// cyclicColor — циклическая палитра: цвета при фазах -π и π совпадают,
+// а яркость меняется плавно, без резких границ как у круга оттенков
+func cyclicColor(phase float64) color.RGBA {
+	channel := func(shift float64) uint8 {
+		return uint8(math.Round(255 * (0.5 + 0.45*math.Cos(phase-shift))))
+	}
+	return color.RGBA{channel(0), channel(2 * math.Pi / 3), channel(4 * math.Pi / 3), 255}
+}
+
+// hsvColor переводит HSV в RGB; h — доля оборота (любое число), s и v в [0...1]
+func hsvColor(h, s, v float64) color.RGBA {
+	h = (h - math.Floor(h)) * 6
+	v = math.Min(1, math.Max(0, v))
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	m := v - c
+	return color.RGBA{uint8(math.Round(255 * (r + m))), uint8(math.Round(255 * (g + m))), uint8(math.Round(255 * (b + m))), 255}
+}
+
+// unwrapPhase убирает скачки на 2π между соседними отсчётами
+func unwrapPhase(phase []float64) []float64 {
+	unwrapped := make([]float64, len(phase))
+	var offset float64
+	for i, p := range phase {
+		if i > 0 {
+			d := p - phase[i-1]
+			offset -= 2 * math.Pi * math.Round(d/(2*math.Pi))
+		}
+		unwrapped[i] = p + offset
+	}
+	return unwrapped
+}
+
+// PhasePlot строит фазу вдоль центральной линии экрана: точками —
+// свёрнутую в (-π, π], линией — развёрнутую. В центре все точки края
+// находятся на одинаковом расстоянии, их вклады приходят в одной фазе
+// и складываются — так возникает пятно Пуассона.
+func (s *Simulation) PhasePlot() (*plot.Plot, error) {
+	scale := s.ScreenWidth / float64(s.Width)
+	phase := make([]float64, s.Width)
+	xs := make([]float64, s.Width)
+	for x := 0; x < s.Width; x++ {
+		xPos, yPos, u := s.linePosition(x, scale)
+		re, im := s.Amplitude(xPos, yPos)
+		xs[x] = u * 1000
+		phase[x] = math.Atan2(im, re)
+	}
+	unwrapped := unwrapPhase(phase)
+
+	// Развёрнутая фаза сдвигается так, чтобы в центре она совпадала со свёрнутой
+	center := s.Width / 2
+	shift := phase[center] - unwrapped[center]
+	wrappedXYs := make(plotter.XYs, s.Width)
+	unwrappedXYs := make(plotter.XYs, s.Width)
+	for i := range xs {
+		wrappedXYs[i] = plotter.XY{X: xs[i], Y: phase[i]}
+		unwrappedXYs[i] = plotter.XY{X: xs[i], Y: unwrapped[i] + shift}
+	}
+
+	p := plot.New()
+	p.Title.Text = "Фаза амплитуды вдоль центральной линии"
+	p.X.Label.Text = "Расстояние от центра, мм"
+	p.Y.Label.Text = "arg(A), рад"
+
+	scatter, err := plotter.NewScatter(wrappedXYs)
+	if err != nil {
+		return nil, err
+	}
+	scatter.GlyphStyle.Radius = vg.Points(0.6)
+	scatter.GlyphStyle.Shape = draw.CircleGlyph{}
+	scatter.Color = color.RGBA{R: 150, G: 150, B: 150, A: 255}
+
+	line, err := plotter.NewLine(unwrappedXYs)
+	if err != nil {
+		return nil, err
+	}
+	line.Color = color.RGBA{R: 30, G: 90, B: 200, A: 255}
+
+	p.Add(plotter.NewGrid(), scatter, line)
+	p.Legend.Add("свёрнутая", scatter)
+	p.Legend.Add("развёрнутая", line)
+	p.Legend.Top = true
+	p.X.Min = -s.ScreenWidth * 1000 / 2
+	p.X.Max = s.ScreenWidth * 1000 / 2
+
+	s.logf("Фаза в центре экрана: %.4f рад\n", phase[center])
+	return p, nil
+}
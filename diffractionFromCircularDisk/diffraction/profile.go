@@ -0,0 +1,373 @@
+package diffraction
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"math"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+// ProfileKind — линия, вдоль которой строится профиль интенсивности
+type ProfileKind string
+
+const (
+	ProfileCenter ProfileKind = "center" // центральная горизонтальная линия экрана
+	ProfileLine   ProfileKind = "line"   // отрезок между двумя точками экрана
+	ProfileRadial ProfileKind = "radial" // среднее по окружностям вокруг центра тени
+)
+
+func ParseProfileKind(s string) (ProfileKind, error) {
+	switch k := ProfileKind(s); k {
+	case ProfileCenter, ProfileLine, ProfileRadial:
+		return k, nil
+	}
+	return "", fmt.Errorf("неизвестный профиль %q (ожидается center, line или radial)", s)
+}
+
+// Overlay — кривые, которые рисуются поверх профиля для сравнения
+type Overlay string
+
+const (
+	OverlayAuto     Overlay = "auto"     // волна без препятствия в физической нормировке
+	OverlayNone     Overlay = "none"     // только расчёт
+	OverlayFree     Overlay = "free"     // волна без препятствия
+	OverlayAnalytic Overlay = "analytic" // аналитическое решение (функции Ломмеля)
+	OverlayBoth     Overlay = "both"     // волна без препятствия и аналитическое решение
+)
+
+func ParseOverlay(s string) (Overlay, error) {
+	switch o := Overlay(s); o {
+	case OverlayAuto, OverlayNone, OverlayFree, OverlayAnalytic, OverlayBoth:
+		return o, nil
+	}
+	return "", fmt.Errorf("неизвестная кривая сравнения %q (ожидается auto, none, free, analytic или both)", s)
+}
+
+// Углов на окружности, по которым усредняется радиальный профиль
+const radialAverageAngles = 64
+
+// Нижняя граница логарифмической шкалы интенсивности относительно максимума:
+// в тени интенсивность почти нулевая и иначе заняла бы всю шкалу
+const logIntensityRange = 1e-6
+
+// ProfileSpec задаёт линию профиля. Нулевое значение — центральная
+// горизонтальная линия экрана, по отсчёту на столбец пикселей.
+// Координаты на экране отсчитываются от его центра, y растёт вниз,
+// как строки изображения.
+type ProfileSpec struct {
+	Kind     ProfileKind
+	From, To [2]float64 // концы отрезка для ProfileLine, м
+	Radius   float64    // наибольший радиус ProfileRadial, м; 0 — половина ширины экрана
+	Points   int        // отсчётов на отрезке или радиусов; 0 — с шагом в пиксель
+}
+
+func (spec ProfileSpec) Validate() error {
+	if spec.Kind != "" {
+		if _, err := ParseProfileKind(string(spec.Kind)); err != nil {
+			return err
+		}
+	}
+	if math.IsNaN(spec.Radius) || math.IsInf(spec.Radius, 0) || spec.Radius < 0 {
+		return fmt.Errorf("радиус профиля не может быть отрицательным, получено %v", spec.Radius)
+	}
+	if spec.Points < 0 {
+		return fmt.Errorf("количество отсчётов профиля не может быть отрицательным, получено %d", spec.Points)
+	}
+	if spec.Kind == ProfileLine {
+		for _, v := range append(spec.From[:], spec.To[:]...) {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("неверная координата отрезка %v", v)
+			}
+		}
+		if spec.From == spec.To {
+			return fmt.Errorf("концы отрезка профиля совпадают")
+		}
+	}
+	return nil
+}
+
+// PlotSpec — что рисует ProfilePlot. Нулевое значение — график
+// центральной линии, как у IntensityPlot.
+type PlotSpec struct {
+	Profile ProfileSpec
+	Overlay Overlay
+	LogX    bool // логарифмическая шкала расстояний, только для радиального профиля
+	LogY    bool // логарифмическая шкала интенсивности
+}
+
+func (spec PlotSpec) Validate() error {
+	if err := spec.Profile.Validate(); err != nil {
+		return err
+	}
+	if spec.Overlay != "" {
+		if _, err := ParseOverlay(string(spec.Overlay)); err != nil {
+			return err
+		}
+	}
+	if spec.LogX && spec.Profile.Kind != ProfileRadial {
+		return fmt.Errorf("логарифмическая шкала расстояний возможна только для радиального профиля")
+	}
+	return nil
+}
+
+// profileSamples возвращает координаты отсчётов профиля и для каждого —
+// точки картины, по которым он усредняется
+func (s *Simulation) profileSamples(spec ProfileSpec) ([]float64, [][][2]float64) {
+	scale := s.ScreenWidth / float64(s.Width)
+	var xs []float64
+	var points [][][2]float64
+	switch spec.Kind {
+	case ProfileLine:
+		dx, dy := spec.To[0]-spec.From[0], spec.To[1]-spec.From[1]
+		length := math.Hypot(dx, dy)
+		n := spec.Points
+		if n == 0 {
+			n = int(length/scale) + 1
+		}
+		n = max(n, 2)
+		for i := range n {
+			t := float64(i) / float64(n-1)
+			x, y := s.screenPoint(spec.From[0]+t*dx, spec.From[1]+t*dy)
+			xs = append(xs, (t-0.5)*length)
+			points = append(points, [][2]float64{{x, y}})
+		}
+	case ProfileRadial:
+		// Окружности вокруг центра тени; у осесимметричной картины на
+		// экране, перпендикулярном оси, все точки окружности равноправны
+		rMax := spec.Radius
+		if rMax == 0 {
+			rMax = s.ScreenWidth / 2
+		}
+		n := spec.Points
+		if n == 0 {
+			n = int(math.Round(rMax/scale)) + 1
+		}
+		n = max(n, 2)
+		angles := radialAverageAngles
+		if isAxisymmetric(s.obstacle) && !s.Geometry.screenTilted() && !s.Coherence.extended() {
+			angles = 1
+		}
+		u0, v0 := s.SpotPosition()
+		for i := range n {
+			r := rMax * float64(i) / float64(n-1)
+			circle := make([][2]float64, angles)
+			for j := range circle {
+				sin, cos := math.Sincos(2 * math.Pi * float64(j) / float64(angles))
+				circle[j][0], circle[j][1] = s.screenPoint(u0+r*cos, v0+r*sin)
+			}
+			xs = append(xs, r)
+			points = append(points, circle)
+		}
+	default:
+		for x := 0; x < s.Width; x++ {
+			xPos, yPos, u := s.linePosition(x, scale)
+			xs = append(xs, u)
+			points = append(points, [][2]float64{{xPos, yPos}})
+		}
+	}
+	return xs, points
+}
+
+// ProfileAlong считает интенсивность вдоль линии spec. X отсчёта —
+// расстояние от центра экрана для центральной линии, от середины
+// отрезка для ProfileLine и радиус для ProfileRadial. Радиальный профиль
+// усредняет интенсивность и её ошибку по окружности. После отмены ctx
+// возвращается ошибка контекста.
+func (s *Simulation) ProfileAlong(ctx context.Context, spec ProfileSpec) ([]ProfilePoint, error) {
+	xs, points := s.profileSamples(spec)
+	return s.sampleProfile(ctx, xs, points)
+}
+
+// sampleProfile считает интенсивность в отсчётах профиля
+func (s *Simulation) sampleProfile(ctx context.Context, xs []float64, points [][][2]float64) ([]ProfilePoint, error) {
+	profile := make([]ProfilePoint, len(xs))
+	err := s.parallelRowsContext(ctx, len(xs), func(i int) {
+		var intens, stdErr float64
+		for _, p := range points[i] {
+			v, se := s.intensityWithError(p[0], p[1])
+			intens += v
+			stdErr += se
+		}
+		n := float64(len(points[i]))
+		profile[i] = ProfilePoint{X: xs[i], Intensity: intens / n, StdErr: stdErr / n}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// averageAlong усредняет fn по точкам каждого отсчёта профиля
+func averageAlong(points [][][2]float64, fn func(x, y float64) float64) []float64 {
+	values := make([]float64, len(points))
+	for i, circle := range points {
+		for _, p := range circle {
+			values[i] += fn(p[0], p[1])
+		}
+		values[i] /= float64(len(circle))
+	}
+	return values
+}
+
+// freeIntensity возвращает интенсивность волны без препятствия в точке
+// картины в единицах поля, то есть с множителем зон Френеля
+func (s *Simulation) freeIntensity(x, y float64) float64 {
+	at := func(wl, x, y float64) float64 {
+		wave := s.incidentWaveAt(wl, s.distanceAt(x, y))
+		re, im := wave.geometric(x, y)
+		return (re*re + im*im) * wave.power() * math.Pow(s.fresnelFactorAt(wl), 2)
+	}
+	if s.contributions == nil {
+		return at(s.Wavelength, x, y)
+	}
+	var intens float64
+	for _, c := range s.contributions {
+		intens += c.weight * at(c.wavelength, x-c.shiftX, y-c.shiftY)
+	}
+	return intens
+}
+
+// Кривая графика профиля
+type profileCurve struct {
+	name   string
+	values []float64
+	color  color.RGBA
+	dashed bool
+}
+
+// ProfilePlot строит профиль интенсивности вдоль линии spec.Profile.
+// Кривые сравнения — волна без препятствия и аналитическое решение —
+// пересчитываются в единицы расчёта. Шкалы подбираются по данным; на
+// логарифмической шкале неположительные значения не рисуются.
+func (s *Simulation) ProfilePlot(spec PlotSpec) (*plot.Plot, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	p := plot.New()
+	switch spec.Profile.Kind {
+	case ProfileLine:
+		p.Title.Text = "Распределение интенсивности вдоль отрезка"
+		p.X.Label.Text = "Расстояние от середины отрезка, мм"
+	case ProfileRadial:
+		p.Title.Text = "Среднее по окружностям вокруг центра тени"
+		p.X.Label.Text = "Радиус, мм"
+	default:
+		p.Title.Text = "Распределение интенсивности"
+		p.X.Label.Text = "Расстояние от центра, мм"
+	}
+	p.Y.Label.Text = "Абсолютная интенсивность"
+	if s.Normalization == NormalizePhysical {
+		p.Y.Label.Text = "I/I0"
+	}
+
+	xs, points := s.profileSamples(spec.Profile)
+	profile, _ := s.sampleProfile(context.Background(), xs, points)
+	xs = make([]float64, len(profile))
+	intensity := make([]float64, len(profile))
+	for i, pp := range profile {
+		xs[i], intensity[i] = pp.X*1000, pp.Intensity
+	}
+
+	overlay := spec.Overlay
+	if overlay == "" || overlay == OverlayAuto {
+		overlay = OverlayNone
+		if s.Normalization == NormalizePhysical {
+			overlay = OverlayFree
+		}
+	}
+
+	curves := []profileCurve{{name: "расчёт", values: intensity, color: color.RGBA{A: 255}}}
+	if overlay == OverlayAnalytic || overlay == OverlayBoth {
+		exact, ok := s.referenceIntensity()
+		if ok && !s.Geometry.screenTilted() {
+			f2 := math.Pow(s.fresnelFactorAt(s.Wavelength), 2)
+			curves = append(curves, profileCurve{
+				name:   "Ломмель",
+				values: averageAlong(points, func(x, y float64) float64 { return exact(x, y) * f2 }),
+				color:  color.RGBA{R: 30, G: 90, B: 200, A: 255},
+			})
+		} else {
+			s.logf("Аналитического решения для этой задачи нет, на графике только расчёт\n")
+		}
+	}
+	if overlay == OverlayFree || overlay == OverlayBoth {
+		// Уровень волны без препятствия: за диском на оси интенсивность должна его достигать
+		label := "без препятствия"
+		if s.Illumination.plane() && s.Normalization == NormalizePhysical {
+			label = "I0"
+		}
+		curves = append(curves, profileCurve{
+			name:   label,
+			values: averageAlong(points, s.freeIntensity),
+			color:  color.RGBA{R: 200, G: 40, B: 40, A: 255},
+			dashed: true,
+		})
+	}
+
+	var maxY float64
+	minY := math.Inf(1)
+	for _, c := range curves {
+		for _, v := range c.values {
+			maxY = math.Max(maxY, v)
+			if v > 0 {
+				minY = math.Min(minY, v)
+			}
+		}
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+	if math.IsInf(minY, 1) {
+		minY = maxY * logIntensityRange
+	}
+
+	for i, c := range curves {
+		xys := make(plotter.XYs, 0, len(xs))
+		for j, v := range c.values {
+			if (spec.LogX && xs[j] <= 0) || (spec.LogY && v <= 0) {
+				continue
+			}
+			xys = append(xys, plotter.XY{X: xs[j], Y: v})
+		}
+		line, err := plotter.NewLine(xys)
+		if err != nil {
+			return nil, err
+		}
+		line.Color = c.color
+		if c.dashed {
+			line.Dashes = []vg.Length{vg.Points(3), vg.Points(2)}
+		}
+		p.Add(line)
+		// Расчёт подписывается, только если рядом другая сплошная кривая
+		if i > 0 || (len(curves) > 1 && !curves[1].dashed) {
+			p.Legend.Add(c.name, line)
+		}
+	}
+	p.Add(plotter.NewGrid())
+	p.Legend.Top = true
+
+	if spec.LogX {
+		p.X.Scale = plot.LogScale{}
+		p.X.Tick.Marker = plot.LogTicks{Prec: -1}
+	} else {
+		p.X.Min, p.X.Max = xs[0], xs[len(xs)-1]
+		if spec.Profile.Kind == "" || spec.Profile.Kind == ProfileCenter {
+			p.X.Min = -s.ScreenWidth * 1000 / 2
+			p.X.Max = s.ScreenWidth * 1000 / 2
+		}
+	}
+	if spec.LogY {
+		p.Y.Scale = plot.LogScale{}
+		p.Y.Tick.Marker = plot.LogTicks{Prec: -1}
+		p.Y.Min = math.Max(minY, maxY*logIntensityRange)
+		p.Y.Max = 2 * maxY
+	} else {
+		p.Y.Min = 0
+		p.Y.Max = 1.1 * maxY
+	}
+	return p, nil
+}
@@ -0,0 +1,119 @@
+package diffraction
+
+import (
+	"fmt"
+	"math"
+)
+
+// Kernel — ядро распространения волны от точки края до точки экрана.
+//
+// Ядро paraxial — сумма по краю в параксиальном приближении: средняя по
+// точкам края волна с фазой k(dx²+dy²)/(2z), а в физической нормировке —
+// волна края с той же фазой (см. boundaryWave). Ядра fk, rs1 и rs2 считают
+// интегралы Френеля-Кирхгофа и Рэлея-Зоммерфельда по открытой части
+// плоскости без параксиального приближения. Для плоской волны интеграл по
+// площади по теореме Стокса точно переходит в интеграл по краю (волна края
+// Маджи-Рубиновича):
+//
+//	U = U_геом + (1/2π) ∮ O(θ) e^{ik(R−z)} dφ,
+//
+// где U_геом = 1 вне геометрической тени и 0 в тени, φ — угол, под которым
+// край виден из основания перпендикуляра, опущенного из точки экрана на
+// плоскость препятствия, R — расстояние до точки края, cosθ = z/R, а
+// множитель наклона O входит один раз: cosθ у первой формулы
+// Рэлея-Зоммерфельда, 1 у второй и (1+cosθ)/2 у Френеля-Кирхгофа.
+type Kernel string
+
+const (
+	KernelParaxial            Kernel = "paraxial" // параксиальное приближение Френеля
+	KernelFresnelKirchhoff    Kernel = "fk"       // интеграл Френеля-Кирхгофа
+	KernelRayleighSommerfeld1 Kernel = "rs1"      // первая формула Рэлея-Зоммерфельда
+	KernelRayleighSommerfeld2 Kernel = "rs2"      // вторая формула Рэлея-Зоммерфельда
+)
+
+func ParseKernel(s string) (Kernel, error) {
+	switch k := Kernel(s); k {
+	case KernelParaxial, KernelFresnelKirchhoff, KernelRayleighSommerfeld1, KernelRayleighSommerfeld2:
+		return k, nil
+	}
+	return "", fmt.Errorf("неизвестное ядро распространения %q (ожидается paraxial, fk, rs1 или rs2)", s)
+}
+
+// edgeContribution возвращает комплексный вклад точки края, смещённой
+// на (dx, dy) относительно точки экрана, на расстоянии z. При boundary
+// вклад — слагаемое волны края: интеграл берётся по углу φ,
+// dφ = (ρ × dQ)/ρ², где (tx, ty) — производная контура по параметру t
+// в этой точке. Фаза отсчитывается от осевого пути z.
+func edgeContribution(kernel Kernel, boundary bool, dx, dy, tx, ty, k, z float64) (float64, float64) {
+	rho2 := dx*dx + dy*dy
+	if !boundary {
+		phase := (k / (2 * z)) * rho2 //	формула Френеля
+		return math.Cos(phase), math.Sin(phase)
+	}
+	if rho2 == 0 {
+		return 0, 0 // точка экрана над самым краем: угол не определён
+	}
+
+	phase, obliquity := (k/(2*z))*rho2, 1.0
+	if kernel != KernelParaxial {
+		r := math.Sqrt(rho2 + z*z)
+		cosTheta := z / r
+		phase = k * rho2 / (r + z) // k(r - z) без потери точности при r ≈ z
+		switch kernel {
+		case KernelFresnelKirchhoff:
+			obliquity = (1 + cosTheta) / 2
+		case KernelRayleighSommerfeld1:
+			obliquity = cosTheta
+		}
+	}
+	// Вектор от основания перпендикуляра до точки края равен (−dx, −dy)
+	amp := obliquity * (dy*tx - dx*ty) / rho2 / (2 * math.Pi)
+	return amp * math.Cos(phase), amp * math.Sin(phase)
+}
+
+// boundaryWave сообщает, считается ли сумма по краю как волна края
+// с падающей волной вне геометрической тени. Непараксиальные ядра иначе не
+// считаются. Параксиальное ядро в физической нормировке тоже переходит на
+// волну края — это точный интеграл Френеля, дающий I/I0 во всём поле, —
+// если волна плоская, а у края известно направление обхода. Иначе сумма
+// по краю — средняя по точкам края волна, верная на оси и в тени.
+func (s *Simulation) boundaryWave() bool {
+	if s.Kernel != KernelParaxial {
+		return true
+	}
+	return s.Normalization == NormalizePhysical && s.Illumination.plane() && !hasMask(s.obstacle)
+}
+
+// Расстояние до края в долях Radius, на котором точка считается лежащей на краю
+const edgeTolerance = 1e-9
+
+// geometricWave возвращает амплитуду волны без дифракции, к которой
+// добавляется сумма по краю: у волны края это падающая волна вне
+// геометрической тени, иначе — Bias препятствия. Над самым краем волна
+// края берётся в смысле главного значения, а падающая волна — наполовину.
+func (s *Simulation) geometricWave(x, y float64) float64 {
+	if !s.boundaryWave() {
+		return s.obstacle.Bias()
+	}
+	opaque := s.obstacle.Opaque(x, y)
+	e := edgeTolerance * s.Radius
+	for _, d := range [][2]float64{{e, 0}, {-e, 0}, {0, e}, {0, -e}} {
+		if s.obstacle.Opaque(x+d[0], y+d[1]) != opaque {
+			return 0.5
+		}
+	}
+	if opaque {
+		return 0
+	}
+	return 1
+}
+
+// checkParaxialValidity предупреждает, если отброшенный член разложения
+// k·ρ⁴/(8z³) для самой дальней пары точек края и экрана превышает π/2
+func (s *Simulation) checkParaxialValidity(k, z, edgeRadius, screenHalfDiagonal float64) {
+	rho := edgeRadius + screenHalfDiagonal
+	err := k * math.Pow(rho, 4) / (8 * z * z * z)
+	if err > math.Pi/2 {
+		s.logf("Внимание: параксиальное приближение нарушено (ошибка фазы до %.1f рад), выберите ядро fk, rs1 или rs2 или метод -solver angular\n", err)
+	}
+}
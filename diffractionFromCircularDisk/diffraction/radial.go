@@ -0,0 +1,153 @@
+package diffraction
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// Шаг радиального профиля в долях пикселя
+const radialOversampling = 4
+
+// isAxisymmetric сообщает, зависит ли картина только от расстояния до оси:
+// препятствие должно быть кругом или кольцом с центром на оси
+func isAxisymmetric(o Obstacle) bool {
+	switch o := o.(type) {
+	case Disk, Annulus:
+		return true
+	case Complement:
+		return isAxisymmetric(o.Of)
+	}
+	return false
+}
+
+// radialField сообщает, считается ли поле по радиальному профилю:
+// картина на повёрнутом экране осевой симметрии не имеет
+func (s *Simulation) radialField() bool {
+	return s.Radial && isAxisymmetric(s.obstacle) && !s.Geometry.screenTilted()
+}
+
+// Радиальный профиль поля на равномерной сетке r = i·step
+type radialProfile struct {
+	step           float64
+	re, im, stdErr []float64
+	samples        []int // точек края в узле профиля
+	computed       int   // узлов, посчитанных подряд от центра; меньше len(re) — расчёт прерван
+}
+
+// covers сообщает, посчитан ли профиль на расстоянии r
+func (p *radialProfile) covers(r float64) bool {
+	return p.computed == len(p.re) || r/p.step < float64(p.computed-1)
+}
+
+// at возвращает амплитуду и ошибку на расстоянии r линейной интерполяцией
+func (p *radialProfile) at(r float64) (float64, float64, float64) {
+	t := r / p.step
+	i := min(int(t), len(p.re)-2)
+	f := t - float64(i)
+	lerp := func(v []float64) float64 { return v[i]*(1-f) + v[i+1]*f }
+	return lerp(p.re), lerp(p.im), lerp(p.stdErr)
+}
+
+// samplesAt возвращает количество точек края в ближайшем к r узле профиля
+func (p *radialProfile) samplesAt(r float64) int {
+	return p.samples[min(int(math.Round(r/p.step)), len(p.samples)-1)]
+}
+
+// computeRadialProfile считает амплитуду вдоль положительной полуоси x
+// от центра картины до самого далёкого угла экрана и показывает прогресс
+// в узлах в секунду. Узлы раздаются от центра, поэтому после отмены ctx
+// профиль посчитан до некоторого радиуса; возвращается ошибка контекста.
+func (s *Simulation) computeRadialProfile(ctx context.Context) (*radialProfile, error) {
+	levels := s.sampleLevels()
+	scale := s.ScreenWidth / float64(s.Width)
+	rMax := math.Hypot(float64(s.Width), float64(s.Height))/2*scale + math.Hypot(s.offsetX, s.offsetY)
+	step := scale / radialOversampling
+	n := int(math.Ceil(rMax/step)) + 2
+
+	p := &radialProfile{
+		step:    step,
+		re:      make([]float64, n),
+		im:      make([]float64, n),
+		stdErr:  make([]float64, n),
+		samples: make([]int, n),
+	}
+	s.logf("Осесимметричная задача: радиальный профиль из %d точек вместо %d пикселей\n", n, s.Width*s.Height)
+	bar := progressbar.NewOptions(
+		n,
+		progressbar.OptionSetWriter(s.log),
+		progressbar.OptionSetDescription("Радиальный профиль..."),
+		progressbar.OptionSetWidth(30),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetItsString("точ"),
+		progressbar.OptionThrottle(100*time.Millisecond),
+	)
+	done := make([]bool, n)
+	err := s.parallelRowsContext(ctx, n, func(i int) {
+		p.re[i], p.im[i], p.stdErr[i], p.samples[i] = s.adaptiveAmplitude(levels, float64(i)*step, 0)
+		done[i] = true
+		_ = bar.Add(1)
+	})
+	s.logf("\n")
+	for p.computed < n && done[p.computed] {
+		p.computed++
+	}
+	return p, err
+}
+
+// computeRadialField — быстрый путь для осесимметричных задач: амплитуда
+// считается один раз на мелкой радиальной сетке и интерполируется на пиксели.
+// Вместо Width·Height сумм по краю нужно около половины диагонали
+// изображения, умноженной на radialOversampling. После отмены ctx
+// поле заполняется до посчитанного радиуса и возвращается с Partial = true.
+func (s *Simulation) computeRadialField(ctx context.Context) *Field {
+	profile, err := s.computeRadialProfile(ctx)
+
+	scale := s.ScreenWidth / float64(s.Width)
+	diskCenterX, diskCenterY := s.shadowCenter(scale)
+	fresnelFactor := s.fresnelFactorAt(s.Wavelength)
+
+	field := s.newField()
+	s.parallelRows(s.Height, func(y int) {
+		for x := 0; x < s.Width; x++ {
+			xPos, yPos := s.screenPosition(x, y, scale)
+			r := math.Hypot(xPos, yPos)
+			field.Opaque[y][x] = s.obstacle.Opaque(xPos, yPos)
+			if !profile.covers(r) {
+				continue
+			}
+			re, im, se := profile.at(r)
+			intens := re*re + im*im
+
+			// Пятно Пуассона в тени — как в computeEdgeSumField
+			if s.skipShadow(x, y, field.Opaque[y][x]) {
+				if max(abs(x-diskCenterX), abs(y-diskCenterY)) <= poissonRadius {
+					field.Intensity[y][x] = intens * fresnelFactor
+					field.Re[y][x], field.Im[y][x] = spotAmplitude(re, im, fresnelFactor)
+				}
+				continue
+			}
+			field.Intensity[y][x] = intens
+			field.StdErr[y][x] = se
+			field.Re[y][x], field.Im[y][x] = re, im
+			if field.SamplesUsed != nil {
+				field.SamplesUsed[y][x] = profile.samplesAt(r)
+			}
+		}
+	})
+
+	for y := range field.Intensity {
+		for x, intens := range field.Intensity[y] {
+			if !field.Opaque[y][x] {
+				field.MaxIntensity = math.Max(field.MaxIntensity, intens)
+			}
+		}
+	}
+	if field.MaxIntensity == 0 {
+		field.MaxIntensity = 1
+	}
+	field.Partial = err != nil
+	return field
+}
@@ -0,0 +1,295 @@
+package diffraction
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"math/cmplx"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+)
+
+// Шаг радиальной сетки аналитического решения в долях пикселя
+const referenceOversampling = 4
+
+// lommelSeries считает Σ (-1)^s w^(n+2s) J_(n+2s)(v). Ряд сходится быстро
+// при w < 1, поэтому для функций V берётся w = v/u, а для U — w = u/v.
+func lommelSeries(n int, w, v float64) float64 {
+	var sum float64
+	pw := math.Pow(w, float64(n))
+	sign := 1.0
+	for s := 0; s < 1000; s++ {
+		order := n + 2*s
+		term := sign * pw * math.Jn(order, v)
+		sum += term
+		if float64(order) > v && math.Abs(term) <= 1e-16*math.Max(1, math.Abs(sum)) {
+			break
+		}
+		pw *= w * w
+		sign = -sign
+	}
+	return sum
+}
+
+// diskFieldLommel — точное решение Френеля для непрозрачного диска
+// при падении плоской волны единичной амплитуды. u = k a²/z, v = k a r/z.
+// В тени (v < u) используются функции V: U = e^(iy) (V0 - i V1),
+// вне тени — функции U: U = 1 + e^(iy) (U2 + i U1), где y = u/2 + v²/(2u).
+func diskFieldLommel(u, v float64) complex128 {
+	y := u/2 + v*v/(2*u)
+	phase := cmplx.Exp(complex(0, y))
+	if v < u {
+		w := v / u
+		return phase * complex(lommelSeries(0, w, v), -lommelSeries(1, w, v))
+	}
+	w := u / v
+	return 1 + phase*complex(lommelSeries(2, w, v), lommelSeries(1, w, v))
+}
+
+// referenceField возвращает аналитическое поле на расстоянии r от оси
+// для диска и круглого отверстия; для остальных препятствий решения нет.
+// Задача с точечным источником на расстоянии q сводится к задаче
+// с плоской волной: расстояние до экрана 1/(1/q + 1/z), картина
+// увеличена в M = (q+z)/q раз и умножена на сферическую волну источника.
+// Для гауссова пучка q комплексное и решения через функции Ломмеля нет.
+func (s *Simulation) referenceField(wl float64) (func(r float64) complex128, bool) {
+	if s.Illumination.Kind == "gaussian" {
+		return nil, false
+	}
+	k := 2 * math.Pi / wl
+	wave := s.incidentWave(wl)
+	free := func(r float64) complex128 {
+		re, im := wave.geometric(r, 0)
+		return wave.scale * complex(re, im)
+	}
+	distance := s.Distance
+	if !wave.plane {
+		distance = 1 / (1/s.Distance + real(wave.inv))
+	}
+	disk := func(d Disk) func(r float64) complex128 {
+		u := k * d.R * d.R / distance
+		return func(r float64) complex128 {
+			return free(r) * diskFieldLommel(u, k*d.R*r/s.Distance)
+		}
+	}
+
+	switch o := s.obstacle.(type) {
+	case Disk:
+		return disk(o), true
+	case Complement:
+		if d, ok := o.Of.(Disk); ok {
+			field := disk(d)
+			return func(r float64) complex128 { return free(r) - field(r) }, true
+		}
+	}
+	return nil, false
+}
+
+// referenceProfile табулирует аналитическую интенсивность на мелкой
+// радиальной сетке и возвращает функцию с линейной интерполяцией
+func referenceProfile(field func(r float64) complex128, rMax, step float64) func(r float64) float64 {
+	n := int(math.Ceil(rMax/step)) + 2
+	profile := make([]float64, n)
+	for i := range profile {
+		profile[i] = math.Pow(cmplx.Abs(field(float64(i)*step)), 2)
+	}
+	return func(r float64) float64 {
+		t := r / step
+		i := min(int(t), n-2)
+		f := t - float64(i)
+		return profile[i]*(1-f) + profile[i+1]*f
+	}
+}
+
+// referenceError возвращает среднеквадратичную и максимальную ошибку
+// интенсивности в единицах I/I0 по освещённым пикселям экрана
+func (s *Simulation) referenceError(field *Field, exact func(x, y float64) float64) (float64, float64) {
+	scale := s.ScreenWidth / float64(s.Width)
+	f2 := math.Pow(s.fresnelFactorAt(s.Wavelength), 2)
+
+	var sumSq, maxErr float64
+	count := 0
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			if field.Opaque[y][x] {
+				continue
+			}
+			xPos, yPos := s.screenPosition(x, y, scale)
+			diff := field.Intensity[y][x]/f2 - exact(xPos, yPos)
+			sumSq += diff * diff
+			maxErr = math.Max(maxErr, math.Abs(diff))
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return math.Sqrt(sumSq / float64(count)), maxErr
+}
+
+// screenReferenceProfile строит аналитический профиль, покрывающий весь
+// экран и картины, сдвинутые не больше чем на margin
+func (s *Simulation) screenReferenceProfile(exact func(r float64) complex128, margin float64) func(r float64) float64 {
+	scale := s.ScreenWidth / float64(s.Width)
+	rMax := math.Hypot(float64(s.Width), float64(s.Height))/2*scale + margin
+	return referenceProfile(exact, rMax, scale/referenceOversampling)
+}
+
+// referenceIntensity возвращает точную интенсивность в точке экрана
+// в единицах I/I0. При частичной когерентности это взвешенная сумма
+// сдвинутых картин вкладов; множители зон Френеля вкладов отнесены
+// к множителю на длине волны Wavelength, как в рассчитанном поле.
+func (s *Simulation) referenceIntensity() (func(x, y float64) float64, bool) {
+	if s.contributions == nil {
+		exact, ok := s.referenceField(s.Wavelength)
+		if !ok {
+			return nil, false
+		}
+		profile := s.screenReferenceProfile(exact, math.Hypot(s.offsetX, s.offsetY))
+		return func(x, y float64) float64 { return profile(math.Hypot(x, y)) }, true
+	}
+
+	var margin float64
+	for _, c := range s.contributions {
+		margin = math.Max(margin, math.Hypot(s.offsetX+c.shiftX, s.offsetY+c.shiftY))
+	}
+	f2 := math.Pow(s.fresnelFactorAt(s.Wavelength), 2)
+	profiles := make([]func(r float64) float64, len(s.contributions))
+	weights := make([]float64, len(s.contributions))
+	byWavelength := make(map[float64]func(r float64) float64)
+	for i, c := range s.contributions {
+		profile, done := byWavelength[c.wavelength]
+		if !done {
+			exact, ok := s.referenceField(c.wavelength)
+			if !ok {
+				return nil, false
+			}
+			profile = s.screenReferenceProfile(exact, margin)
+			byWavelength[c.wavelength] = profile
+		}
+		profiles[i] = profile
+		weights[i] = c.weight * math.Pow(s.fresnelFactorAt(c.wavelength), 2) / f2
+	}
+	return func(x, y float64) float64 {
+		var intens float64
+		for i, c := range s.contributions {
+			intens += weights[i] * profiles[i](math.Hypot(x-c.shiftX, y-c.shiftY))
+		}
+		return intens
+	}, true
+}
+
+// Comparison — сравнение расчёта с аналитическим решением, интенсивности
+// в единицах I/I0
+type Comparison struct {
+	RMS, Max                    float64 // ошибка по освещённым пикселям экрана
+	LineRMS, LineMax            float64 // ошибка вдоль центральной линии, включая тень
+	Center, CenterExact         float64 // интенсивность в центре: расчёт и точное решение
+	Kernel                      Kernel
+	simulated, analytic, errors plotter.XYs
+	screenWidth                 float64
+}
+
+// CompareWithReference сравнивает расчёт методом Монте-Карло с аналитическим
+// решением на той же сетке экрана. Интенсивности сравниваются в единицах
+// I/I0, то есть без множителя зон Френеля; при частичной когерентности
+// точное решение усредняется по тем же вкладам. Для препятствий, кроме
+// диска и круглого отверстия, а также для повёрнутого экрана решения нет
+// и ok = false.
+func (s *Simulation) CompareWithReference(field *Field) (c *Comparison, ok bool) {
+	if s.Geometry.screenTilted() {
+		return nil, false
+	}
+	exact, ok := s.referenceIntensity()
+	if !ok {
+		return nil, false
+	}
+
+	scale := s.ScreenWidth / float64(s.Width)
+	f2 := math.Pow(s.fresnelFactorAt(s.Wavelength), 2)
+
+	c = &Comparison{
+		Kernel:      s.Kernel,
+		simulated:   make(plotter.XYs, s.Width),
+		analytic:    make(plotter.XYs, s.Width),
+		errors:      make(plotter.XYs, s.Width),
+		screenWidth: s.ScreenWidth,
+	}
+
+	// Ошибка по всем рассчитанным пикселям
+	c.RMS, c.Max = s.referenceError(field, exact)
+
+	// Центральная линия, включая область тени
+	var lineSumSq float64
+	for x := 0; x < s.Width; x++ {
+		xPos, yPos, u := s.linePosition(x, scale)
+		mc := s.Intensity(xPos, yPos) / f2
+		ref := exact(xPos, yPos)
+		diff := mc - ref
+
+		c.simulated[x] = plotter.XY{X: u * 1000, Y: mc}
+		c.analytic[x] = plotter.XY{X: u * 1000, Y: ref}
+		c.errors[x] = plotter.XY{X: u * 1000, Y: math.Abs(diff)}
+		lineSumSq += diff * diff
+		c.LineMax = math.Max(c.LineMax, math.Abs(diff))
+	}
+	c.LineRMS = math.Sqrt(lineSumSq / float64(s.Width))
+
+	c.Center = s.Intensity(0, 0) / f2
+	c.CenterExact = exact(0, 0)
+	return c, true
+}
+
+// Report пишет отчёт о точности
+func (c *Comparison) Report(w io.Writer) {
+	fmt.Fprintln(w, "Сравнение с аналитическим решением (функции Ломмеля), интенсивность в единицах I/I0")
+	fmt.Fprintf(w, "Среднеквадратичная ошибка по экрану: %.6f\n", c.RMS)
+	fmt.Fprintf(w, "Максимальная ошибка по экрану: %.6f\n", c.Max)
+	fmt.Fprintf(w, "Среднеквадратичная ошибка вдоль центральной линии: %.6f\n", c.LineRMS)
+	fmt.Fprintf(w, "Максимальная ошибка вдоль центральной линии: %.6f\n", c.LineMax)
+	fmt.Fprintf(w, "Интенсивность в центре: расчёт %.6f, точное решение %.6f\n", c.Center, c.CenterExact)
+	if c.Kernel != KernelParaxial {
+		fmt.Fprintln(w, "Аналитическое решение параксиальное, ядро", c.Kernel, "может от него отличаться")
+	}
+}
+
+// Plot строит расчёт, точное решение и модуль ошибки вдоль центральной линии
+func (c *Comparison) Plot() (*plot.Plot, error) {
+	p := plot.New()
+	p.Title.Text = "Сравнение с аналитическим решением"
+	p.X.Label.Text = "Расстояние от центра, мм"
+	p.Y.Label.Text = "I/I0"
+
+	lines := []struct {
+		name  string
+		xys   plotter.XYs
+		color color.RGBA
+	}{
+		{"Монте-Карло", c.simulated, color.RGBA{R: 30, G: 90, B: 200, A: 255}},
+		{"Ломмель", c.analytic, color.RGBA{R: 200, G: 40, B: 40, A: 255}},
+		{"|ошибка|", c.errors, color.RGBA{R: 60, G: 160, B: 60, A: 255}},
+	}
+	var maxY float64
+	for _, l := range lines {
+		for _, xy := range l.xys {
+			maxY = math.Max(maxY, xy.Y)
+		}
+		line, err := plotter.NewLine(l.xys)
+		if err != nil {
+			return nil, err
+		}
+		line.Color = l.color
+		p.Add(line)
+		p.Legend.Add(l.name, line)
+	}
+	p.Add(plotter.NewGrid())
+	p.Legend.Top = true
+
+	p.X.Min = -c.screenWidth * 1000 / 2
+	p.X.Max = c.screenWidth * 1000 / 2
+	p.Y.Min = 0
+	p.Y.Max = 1.4 * maxY // место для легенды над кривыми
+	return p, nil
+}
@@ -0,0 +1,50 @@
+package diffraction
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+// Сумма по краю совпадает с решением через функции Ломмеля. Для неплоской
+// волны сумма по краю верна только на оси и в тени, поэтому сравнивается
+// лишь интенсивность в центре.
+func TestCompareWithReference(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []Option
+		rms  float64 // допустимая ошибка по экрану; 0 — сравнивается только центр
+	}{
+		{"диск", nil, 0.01},
+		{"диск по пикселям", []Option{func(c *Config) { c.Radial = false }}, 0.02},
+		{"круглое отверстие", []Option{WithObstacle(ObstacleSpec{Kind: "aperture"})}, 0.01},
+		{"ядро rs2", []Option{WithKernel(KernelRayleighSommerfeld2)}, 0.01},
+		// Точное решение для сдвинутых вкладов интерполируется с шагом пикселя
+		{"протяжённый источник", []Option{
+			WithSize(64, 64),
+			WithSamples(4000, SamplingUniform),
+			WithCoherence(CoherenceSpec{Source: "disk", AngularSize: 2e-3, SourceSamples: 5}),
+		}, 0.02},
+		{"точечный источник", []Option{WithIllumination(IlluminationSpec{Kind: "point", SourceDistance: 0.05})}, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sim := testSimulation(t, append([]Option{WithSamples(20000, SamplingUniform), WithNormalization(NormalizePhysical)}, tc.opts...)...)
+			c, ok := sim.CompareWithReference(sim.Field(context.Background()))
+			if !ok {
+				t.Fatalf("нет аналитического решения")
+			}
+			if math.Abs(c.Center-c.CenterExact) > 0.01*c.CenterExact {
+				t.Errorf("интенсивность в центре %.6f, точное решение %.6f", c.Center, c.CenterExact)
+			}
+			if tc.rms > 0 && c.RMS > tc.rms {
+				t.Errorf("среднеквадратичная ошибка по экрану %.4f больше %.4f", c.RMS, tc.rms)
+			}
+		})
+	}
+
+	sim := testSimulation(t, WithObstacle(ObstacleSpec{Kind: "polygon", Sides: 6}))
+	if _, ok := sim.CompareWithReference(sim.Field(context.Background())); ok {
+		t.Errorf("для многоугольника аналитического решения нет")
+	}
+}
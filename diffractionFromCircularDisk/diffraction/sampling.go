@@ -0,0 +1,178 @@
+package diffraction
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// SamplingMethod — метод размещения точек на краю препятствия
+type SamplingMethod string
+
+const (
+	SamplingRandom     SamplingMethod = "random"     // случайные углы (Монте-Карло)
+	SamplingUniform    SamplingMethod = "uniform"    // равномерная угловая сетка
+	SamplingGauss      SamplingMethod = "gauss"      // составная квадратура Гаусса-Лежандра
+	SamplingStratified SamplingMethod = "stratified" // стратифицированная выборка с дрожанием
+)
+
+// Порядок квадратуры Гаусса-Лежандра на одной панели
+const gaussPanelOrder = 16
+
+// Размер блока случайных чисел: от него зависит последовательность,
+// поэтому он фиксирован и не связан с количеством ядер
+const randomChunkSize = 4096
+
+func ParseSamplingMethod(s string) (SamplingMethod, error) {
+	switch m := SamplingMethod(s); m {
+	case SamplingRandom, SamplingUniform, SamplingGauss, SamplingStratified:
+		return m, nil
+	}
+	return "", fmt.Errorf("неизвестный метод выборки %q (ожидается random, uniform, gauss или stratified)", s)
+}
+
+// sampleParameters возвращает n значений параметра t ∈ [0, 1) и их веса.
+// Сумма весов равна 1, поэтому амплитуда считается как взвешенная сумма фаз.
+func sampleParameters(n int, method SamplingMethod, seed int64, workers int) ([]float64, []float64) {
+	t := make([]float64, n)
+	w := make([]float64, n)
+	if n == 0 {
+		return t, w
+	}
+
+	switch method {
+	case SamplingUniform:
+		for i := range t {
+			t[i] = float64(i) / float64(n)
+			w[i] = 1 / float64(n)
+		}
+	case SamplingStratified:
+		rng := rand.New(rand.NewSource(seed))
+		for i := range t {
+			t[i] = (float64(i) + rng.Float64()) / float64(n)
+			w[i] = 1 / float64(n)
+		}
+	case SamplingGauss:
+		gaussLegendreParameters(t, w)
+	default:
+		randomParameters(t, w, seed, workers)
+	}
+	return t, w
+}
+
+// streamSeed возвращает seed независимой последовательности номер stream,
+// выведенной из seed; нулевая последовательность использует сам seed.
+// Блоки randomParameters получают seed+номер блока, а math/rand берёт seed
+// по модулю 2³¹−1, поэтому простые сдвиги seed+stream или seed+stream<<32
+// совпали бы с seed блоков соседней последовательности. Номер
+// перемешивается с seed функцией splitmix64.
+func streamSeed(seed, stream int64) int64 {
+	if stream == 0 {
+		return seed
+	}
+	z := uint64(seed) + uint64(stream)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64((z ^ (z >> 31)) >> 1)
+}
+
+// randomParameters заполняет t случайными значениями параллельно.
+// Каждый блок получает свой генератор seed+номер блока, поэтому результат
+// одинаков на любой машине независимо от числа потоков.
+func randomParameters(t, w []float64, seed int64, workers int) {
+	n := len(t)
+	chunks := (n + randomChunkSize - 1) / randomChunkSize
+	numWorkers := workers
+	if numWorkers > chunks {
+		numWorkers = chunks
+	}
+
+	jobs := make(chan int, chunks)
+	for c := 0; c < chunks; c++ {
+		jobs <- c
+	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				rng := rand.New(rand.NewSource(seed + int64(c)))
+				start := c * randomChunkSize
+				end := min(start+randomChunkSize, n)
+				for j := start; j < end; j++ {
+					t[j] = rng.Float64()
+					w[j] = 1 / float64(n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// gaussLegendreParameters разбивает [0, 1) на панели и в каждой
+// использует узлы Гаусса-Лежандра порядка не выше gaussPanelOrder.
+func gaussLegendreParameters(t, w []float64) {
+	n := len(t)
+	panels := (n + gaussPanelOrder - 1) / gaussPanelOrder
+	base, extra := n/panels, n%panels
+
+	i := 0
+	for p := 0; p < panels; p++ {
+		order := base
+		if p < extra {
+			order++
+		}
+		nodes, weights := gaussLegendreNodes(order)
+		a := float64(p) / float64(panels)
+		h := 1 / float64(panels)
+		for j := range nodes {
+			t[i] = a + h*(nodes[j]+1)/2
+			w[i] = h * weights[j] / 2
+			i++
+		}
+	}
+}
+
+var (
+	gaussCacheMu sync.Mutex
+	gaussCache   = map[int][2][]float64{}
+)
+
+// gaussLegendreNodes возвращает узлы и веса Гаусса-Лежандра на [-1, 1].
+// Корни многочленов Лежандра находятся методом Ньютона.
+func gaussLegendreNodes(n int) ([]float64, []float64) {
+	gaussCacheMu.Lock()
+	defer gaussCacheMu.Unlock()
+	if c, ok := gaussCache[n]; ok {
+		return c[0], c[1]
+	}
+
+	x := make([]float64, n)
+	w := make([]float64, n)
+	for i := 0; i < (n+1)/2; i++ {
+		z := math.Cos(math.Pi * (float64(i) + 0.75) / (float64(n) + 0.5))
+		var dp float64
+		for iter := 0; iter < 100; iter++ {
+			p0, p1 := 1.0, 0.0
+			for j := 1; j <= n; j++ {
+				p0, p1 = ((2*float64(j)-1)*z*p0-(float64(j)-1)*p1)/float64(j), p0
+			}
+			dp = float64(n) * (z*p0 - p1) / (z*z - 1)
+			dz := p0 / dp
+			z -= dz
+			if math.Abs(dz) < 1e-15 {
+				break
+			}
+		}
+		x[i], x[n-1-i] = -z, z
+		w[i] = 2 / ((1 - z*z) * dp * dp)
+		w[n-1-i] = w[i]
+	}
+
+	gaussCache[n] = [2][]float64{x, w}
+	return x, w
+}
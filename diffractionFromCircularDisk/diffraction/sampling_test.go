@@ -0,0 +1,74 @@
+package diffraction
+
+import (
+	"math"
+	"testing"
+)
+
+// Блоки последовательностей получают seed+номер блока, а math/rand берёт
+// seed по модулю 2³¹−1: seed блоков разных последовательностей не должны
+// совпадать и после взятия остатка
+func TestStreamSeedBlocksDistinct(t *testing.T) {
+	const mod = 1<<31 - 1
+	const blocks = 64
+	for _, seed := range []int64{0, 1, 42, -7} {
+		seen := make(map[int64]int64)
+		for stream := range int64(8) {
+			for _, s := range []int64{stream, stream << 32} {
+				base := streamSeed(seed, s)
+				for b := range int64(blocks) {
+					key := ((base+b)%mod + mod) % mod
+					if prev, ok := seen[key]; ok && prev != s {
+						t.Fatalf("seed %d: блок %d последовательности %d совпадает с блоком последовательности %d", seed, b, s, prev)
+					}
+					seen[key] = s
+				}
+			}
+		}
+	}
+	if streamSeed(5, 0) != 5 {
+		t.Errorf("нулевая последовательность должна использовать сам seed")
+	}
+}
+
+// Контуры препятствия получают непересекающиеся последовательности
+// случайных чисел и в ближней, и в дальней зоне: внешняя и внутренняя
+// окружности кольца не должны иметь точек на одних и тех же углах
+func TestContourSequencesDistinct(t *testing.T) {
+	o := Annulus{Inner: 0.5, Outer: 1}
+	n := 8 * randomChunkSize
+	cases := []struct {
+		name      string
+		positions func() [][2]float64
+	}{
+		{"ближняя зона", func() [][2]float64 {
+			var pos [][2]float64
+			for _, p := range generateEdgePoints(o, n, SamplingRandom, 3, 4) {
+				pos = append(pos, [2]float64{p.X, p.Y})
+			}
+			return pos
+		}},
+		{"дальняя зона", func() [][2]float64 {
+			var pos [][2]float64
+			for _, e := range generateEdgeElements(o, n, SamplingRandom, 3, 4) {
+				pos = append(pos, [2]float64{e.X, e.Y})
+			}
+			return pos
+		}},
+	}
+	for _, tc := range cases {
+		angles := make(map[float64]bool)
+		shared := 0
+		for _, p := range tc.positions() {
+			a := math.Round(math.Atan2(p[1], p[0]) * 1e9)
+			if math.Hypot(p[0], p[1]) > 0.75 {
+				angles[a] = true
+			} else if angles[a] {
+				shared++
+			}
+		}
+		if shared > 0 {
+			t.Errorf("%s: %d точек внутреннего контура на тех же углах, что и точки внешнего", tc.name, shared)
+		}
+	}
+}
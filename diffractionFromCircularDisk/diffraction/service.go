@@ -0,0 +1,445 @@
+package diffraction
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ограничения на размер одного расчёта в сервисе и в рабочем процессе
+const (
+	serviceMaxPixels   = 4096 * 4096
+	serviceMaxSamples  = 1_000_000
+	serviceMaxFFTGrid  = 8192
+	serviceMaxCoherent = 256     // когерентных вкладов при частичной когерентности
+	serviceMaxSpectrum = 256     // длин волн в спектре источника
+	serviceMaxSides    = 4096    // сторон многоугольника
+	serviceMaxBody     = 1 << 20 // байт в теле запроса
+)
+
+const (
+	serviceDefaultSeed  = 1 // если seed не задан: иначе одинаковые запросы давали бы разные картины
+	serviceDefaultCache = 64
+	serviceDefaultSlots = 2
+)
+
+// ServiceRequest — параметры расчёта в запросе к сервису. Длины задаются
+// в метрах; отсутствующие поля берутся из DefaultConfig.
+type ServiceRequest struct {
+	Wavelength    float64          `json:"wavelength"`
+	Radius        float64          `json:"radius"`
+	Distance      float64          `json:"distance"`
+	Screen        float64          `json:"screen"`
+	Width         int              `json:"width"`
+	Height        int              `json:"height"`
+	Samples       int              `json:"samples"`
+	Sampling      SamplingMethod   `json:"sampling"`
+	Seed          int64            `json:"seed"` // 0 — фиксированный seed сервиса
+	Kernel        Kernel           `json:"kernel"`
+	Solver        SolverMethod     `json:"solver"`
+	FFTGrid       int              `json:"fft_grid"`
+	FFTPadding    float64          `json:"fft_padding"`
+	Radial        bool             `json:"radial"`
+	Adaptive      float64          `json:"adaptive"`
+	AdaptiveMax   int              `json:"adaptive_max"`
+	Normalization Normalization    `json:"normalization"`
+	Obstacle      ObstacleSpec     `json:"obstacle"`
+	Spectrum      SpectrumSpec     `json:"spectrum"`
+	Illumination  IlluminationSpec `json:"illumination"`
+	Coherence     CoherenceSpec    `json:"coherence"`
+	Geometry      GeometrySpec     `json:"geometry"`
+}
+
+func defaultServiceRequest() ServiceRequest {
+	c := DefaultConfig()
+	return ServiceRequest{
+		Wavelength:    c.Wavelength,
+		Radius:        c.Radius,
+		Distance:      c.Distance,
+		Screen:        c.ScreenWidth,
+		Width:         c.Width,
+		Height:        c.Height,
+		Samples:       c.Samples,
+		Sampling:      c.Sampling,
+		Kernel:        c.Kernel,
+		Solver:        c.Solver,
+		FFTGrid:       c.FFTGrid,
+		FFTPadding:    c.FFTPadding,
+		Radial:        c.Radial,
+		Normalization: c.Normalization,
+		Obstacle:      c.Obstacle,
+		Spectrum:      c.Spectrum,
+		Illumination:  c.Illumination,
+		Coherence:     c.Coherence,
+		Geometry:      c.Geometry,
+	}
+}
+
+// config переводит запрос в параметры расчёта; расчёт всегда в ближней зоне
+func (r ServiceRequest) config(workers int) Config {
+	c := DefaultConfig()
+	c.Wavelength, c.Radius, c.Distance, c.ScreenWidth = r.Wavelength, r.Radius, r.Distance, r.Screen
+	c.Width, c.Height = r.Width, r.Height
+	c.Samples, c.Sampling, c.Seed = r.Samples, r.Sampling, r.Seed
+	c.Kernel, c.Solver, c.FFTGrid, c.FFTPadding = r.Kernel, r.Solver, r.FFTGrid, r.FFTPadding
+	c.Regime, c.Radial = RegimeFresnel, r.Radial
+	c.Adaptive, c.AdaptiveMax = r.Adaptive, r.AdaptiveMax
+	c.Normalization, c.Obstacle, c.Spectrum, c.Illumination = r.Normalization, r.Obstacle, r.Spectrum, r.Illumination
+	c.Coherence, c.Geometry = r.Coherence, r.Geometry
+	c.Workers = workers
+	return c
+}
+
+// validate проверяет запрос: параметры расчёта, ограничения сервиса и то,
+// что запрос не ссылается на файлы сервера
+func (r *ServiceRequest) validate() error {
+	if r.Seed == 0 {
+		r.Seed = serviceDefaultSeed
+	}
+	cfg := r.config(1)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.checkLimits(); err != nil {
+		return err
+	}
+	if r.Obstacle.MaskPath != "" || r.Spectrum.TablePath != "" {
+		return errors.New("маски и таблицы спектра из файлов сервиса недоступны")
+	}
+	return nil
+}
+
+// checkLimits проверяет ограничения размера расчёта, заданного по сети:
+// без них любой клиент сервиса или координатор рабочего процесса мог бы
+// занять всю память. Параметры уже проверены Validate.
+func (c *Config) checkLimits() error {
+	// Размеры положительны; деление вместо умножения не переполняется
+	if c.Width > serviceMaxPixels/c.Height {
+		return fmt.Errorf("изображение %dx%d больше допустимого (%d пикселей)", c.Width, c.Height, serviceMaxPixels)
+	}
+	if c.Samples > serviceMaxSamples || c.adaptiveBudget() > serviceMaxSamples {
+		return fmt.Errorf("количество точек края больше допустимого (%d)", serviceMaxSamples)
+	}
+	if c.FFTGrid > serviceMaxFFTGrid {
+		return fmt.Errorf("сетка БПФ больше допустимой (%d узлов)", serviceMaxFFTGrid)
+	}
+	if c.Spectrum.Count > serviceMaxSpectrum || strings.Count(c.Spectrum.Lines, ",") >= serviceMaxSpectrum {
+		return fmt.Errorf("длин волн в спектре больше допустимого (%d)", serviceMaxSpectrum)
+	}
+	if c.Obstacle.Sides > serviceMaxSides {
+		return fmt.Errorf("сторон многоугольника больше допустимого (%d)", serviceMaxSides)
+	}
+	if !c.Coherence.Coherent() && len(c.coherentContributions()) > serviceMaxCoherent {
+		return fmt.Errorf("когерентных вкладов больше допустимого (%d)", serviceMaxCoherent)
+	}
+	return nil
+}
+
+// adaptiveBudget возвращает предел точек адаптивной выборки, который
+// получит расчёт: без AdaptiveMax New берёт DefaultAdaptiveBudget·Samples
+func (c *Config) adaptiveBudget() int {
+	if c.Adaptive == 0 {
+		return 0
+	}
+	if c.AdaptiveMax == 0 {
+		return DefaultAdaptiveBudget * c.Samples
+	}
+	return c.AdaptiveMax
+}
+
+// key возвращает хеш запроса для кеша; kind различает виды результата
+func (r ServiceRequest) key(kind string) string {
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(append([]byte(kind+"\n"), data...))
+	return hex.EncodeToString(sum[:])
+}
+
+// ServiceConfig — параметры HTTP-сервиса расчётов
+type ServiceConfig struct {
+	Workers     int       // потоков на все расчёты; 0 — по числу ядер
+	Concurrency int       // одновременных расчётов; 0 — два
+	CacheSize   int       // готовых результатов в кеше; 0 — 64
+	Log         io.Writer // сообщения о расчётах; nil — не выводить
+}
+
+// Результат в кеше. ready закрывается, когда расчёт закончен; до этого
+// одинаковые запросы ждут его, а не считают повторно.
+type cacheEntry struct {
+	key         string
+	ready       chan struct{}
+	body        []byte
+	contentType string
+	err         error
+	elem        *list.Element // место в очереди вытеснения; nil — расчёт ещё идёт
+}
+
+// Service — HTTP-сервис расчёта картин дифракции. Результаты кешируются
+// по хешу параметров, количество одновременных расчётов ограничено.
+//
+//	POST /image    — картина в PNG
+//	POST /profile  — профиль вдоль центральной линии в JSON (?format=csv — CSV)
+//	POST /zones    — количество открытых зон Френеля и зона дифракции
+type Service struct {
+	cfg     ServiceConfig
+	mux     *http.ServeMux
+	slots   chan struct{} // занятые места для расчётов
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	lru     *list.List // готовые записи, в начале — недавно использованные
+}
+
+// NewService создаёт сервис; его можно подключить к своему http.ServeMux
+func NewService(cfg ServiceConfig) *Service {
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = serviceDefaultSlots
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = serviceDefaultCache
+	}
+	if cfg.Log == nil {
+		cfg.Log = io.Discard
+	}
+	s := &Service{
+		cfg:     cfg,
+		mux:     http.NewServeMux(),
+		slots:   make(chan struct{}, cfg.Concurrency),
+		entries: make(map[string]*cacheEntry),
+		lru:     list.New(),
+	}
+	s.mux.HandleFunc("POST /image", s.handleImage)
+	s.mux.HandleFunc("POST /profile", s.handleProfile)
+	s.mux.HandleFunc("POST /zones", s.handleZones)
+	return s
+}
+
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) { s.mux.ServeHTTP(w, r) }
+
+// ServeSimulations запускает HTTP-сервис расчётов на адресе addr
+func ServeSimulations(addr string, cfg ServiceConfig) error {
+	s := NewService(cfg)
+	fmt.Fprintf(s.cfg.Log, "Сервис расчётов слушает %s, одновременных расчётов: %d, потоков: %d\n", addr, s.cfg.Concurrency, s.cfg.Workers)
+	return http.ListenAndServe(addr, s)
+}
+
+// decode читает запрос поверх параметров по умолчанию и проверяет его
+func (s *Service) decode(w http.ResponseWriter, r *http.Request) (ServiceRequest, bool) {
+	req := defaultServiceRequest()
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, serviceMaxBody))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&req)
+	if errors.Is(err, io.EOF) {
+		err = nil // пустое тело — параметры по умолчанию
+	}
+	if err == nil {
+		err = req.validate()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// simulation строит расчёт; потоки делятся между одновременными расчётами
+func (s *Service) simulation(req ServiceRequest) (*Simulation, error) {
+	return New(WithConfig(req.config(max(1, s.cfg.Workers/s.cfg.Concurrency))))
+}
+
+func (s *Service) handleImage(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.decode(w, r)
+	if !ok {
+		return
+	}
+	s.respond(w, r, req.key("image"), req, func(ctx context.Context) ([]byte, string, error) {
+		sim, err := s.simulation(req)
+		if err != nil {
+			return nil, "", err
+		}
+		img, err := sim.SpectralImage(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		if img == nil {
+			field := sim.Field(ctx)
+			if field.Partial {
+				return nil, "", ctx.Err()
+			}
+			img = sim.Image(field)
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/png", nil
+	})
+}
+
+// Ответ /profile в JSON
+type profileResponse struct {
+	FresnelZones float64        `json:"fresnel_zones"`
+	Profile      []ProfilePoint `json:"profile"`
+}
+
+func (s *Service) handleProfile(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.decode(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, fmt.Sprintf("неизвестный формат %q (ожидается json или csv)", format), http.StatusBadRequest)
+		return
+	}
+	csvFormat := format == "csv"
+	kind := "profile.json"
+	if csvFormat {
+		kind = "profile.csv"
+	}
+
+	s.respond(w, r, req.key(kind), req, func(ctx context.Context) ([]byte, string, error) {
+		sim, err := s.simulation(req)
+		if err != nil {
+			return nil, "", err
+		}
+		profile, err := sim.Profile(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		if !csvFormat {
+			data, err := json.Marshal(profileResponse{FresnelZones: sim.FresnelZones(), Profile: profile})
+			return data, "application/json", err
+		}
+
+		var buf bytes.Buffer
+		cw := csv.NewWriter(&buf)
+		cw.Write([]string{"x_m", "intensity", "std_err"})
+		format := func(v float64) string { return strconv.FormatFloat(v, 'g', 10, 64) }
+		for _, p := range profile {
+			cw.Write([]string{format(p.X), format(p.Intensity), format(p.StdErr)})
+		}
+		cw.Flush()
+		return buf.Bytes(), "text/csv; charset=utf-8", cw.Error()
+	})
+}
+
+// Ответ /zones
+type zonesResponse struct {
+	FresnelZones float64 `json:"fresnel_zones"`
+	Regime       Regime  `json:"regime"` // fresnel или fraunhofer — зона, подходящая для этих параметров
+}
+
+// handleZones ничего не считает и не занимает места для расчётов
+func (s *Service) handleZones(w http.ResponseWriter, r *http.Request) {
+	req, ok := s.decode(w, r)
+	if !ok {
+		return
+	}
+	cfg := req.config(1)
+	cfg.Regime = RegimeAuto
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(zonesResponse{FresnelZones: cfg.FresnelZones(), Regime: cfg.ChooseRegime(io.Discard)})
+}
+
+// respond отдаёт результат из кеша или считает его
+func (s *Service) respond(w http.ResponseWriter, r *http.Request, key string, req ServiceRequest, compute func(context.Context) ([]byte, string, error)) {
+	e, hit, err := s.cached(r.Context(), key, func(ctx context.Context) ([]byte, string, error) {
+		start := time.Now()
+		body, contentType, err := compute(ctx)
+		if err == nil {
+			fmt.Fprintf(s.cfg.Log, "Расчёт %s: %s, %dx%d, %d точек края, %v\n", r.URL.Path, key[:12], req.Width, req.Height, req.Samples, time.Since(start))
+		}
+		return body, contentType, err
+	})
+	if err != nil {
+		if r.Context().Err() != nil {
+			return // клиент ушёл, отвечать некому
+		}
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	cache := "miss"
+	if hit {
+		cache = "hit"
+	}
+	cfg := req.config(1)
+	w.Header().Set("Content-Type", e.contentType)
+	w.Header().Set("ETag", strconv.Quote(key))
+	w.Header().Set("X-Cache", cache)
+	w.Header().Set("X-Fresnel-Zones", strconv.FormatFloat(cfg.FresnelZones(), 'g', 6, 64))
+	w.Write(e.body)
+}
+
+// cached возвращает готовую запись или считает её, дождавшись свободного
+// места. Одинаковые запросы, пришедшие во время расчёта, ждут его результат.
+// Если расчёт прерван, потому что его клиент ушёл, ожидающие повторяют
+// попытку сами.
+func (s *Service) cached(ctx context.Context, key string, compute func(context.Context) ([]byte, string, error)) (*cacheEntry, bool, error) {
+	for {
+		s.mu.Lock()
+		e, found := s.entries[key]
+		if !found {
+			break // блокировка снимается ниже, после добавления записи
+		}
+		done := e.elem != nil
+		if done {
+			s.lru.MoveToFront(e.elem)
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+		if e.err == nil {
+			return e, done, nil
+		}
+		if !errors.Is(e.err, context.Canceled) {
+			return nil, false, e.err
+		}
+	}
+
+	e := &cacheEntry{key: key, ready: make(chan struct{})}
+	s.entries[key] = e
+	s.mu.Unlock()
+
+	select {
+	case s.slots <- struct{}{}:
+		e.body, e.contentType, e.err = compute(ctx)
+		<-s.slots
+	case <-ctx.Done():
+		e.err = ctx.Err()
+	}
+
+	s.mu.Lock()
+	if e.err != nil {
+		delete(s.entries, key) // ошибки не кешируются
+	} else {
+		e.elem = s.lru.PushFront(e)
+		for s.lru.Len() > s.cfg.CacheSize {
+			old := s.lru.Remove(s.lru.Back()).(*cacheEntry)
+			delete(s.entries, old.key)
+		}
+	}
+	s.mu.Unlock()
+	close(e.ready)
+	return e, false, e.err
+}
@@ -0,0 +1,87 @@
+package diffraction
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// post отправляет запрос сервису и возвращает ответ
+func post(s *Service, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	return w
+}
+
+// Запросы больше ограничений сервиса отклоняются до расчёта
+func TestServiceLimits(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"изображение больше допустимого", `{"width": 8192, "height": 4096}`, "изображение"},
+		{"переполнение числа пикселей", `{"width": 4294967296, "height": 4294967296}`, "изображение"},
+		{"точек края больше допустимого", `{"samples": 2000000}`, "точек края"},
+		{"адаптивная выборка без предела", `{"samples": 100000, "adaptive": 0.01}`, "точек края"},
+		{"предел адаптивной выборки больше допустимого", `{"adaptive": 0.01, "adaptive_max": 2000000}`, "точек края"},
+		{"сетка БПФ больше допустимой", `{"solver": "angular", "fft_grid": 16384}`, "сетка БПФ"},
+		{"длин волн больше допустимого", `{"spectrum": {"kind": "blackbody", "temperature": 5800, "count": 1000}}`, "длин волн"},
+		{"сторон многоугольника больше допустимого", `{"obstacle": {"kind": "polygon", "sides": 10000}}`, "сторон"},
+		{"маска из файла", `{"obstacle": {"kind": "mask", "mask": "/etc/passwd"}}`, "файлов"},
+		{"неизвестное поле", `{"colour": "red"}`, "colour"},
+		{"неверные параметры", `{"radius": -1}`, "радиус"},
+	}
+	s := NewService(ServiceConfig{Workers: 1})
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := post(s, "/zones", tc.body)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("ответ %d, ожидается %d", w.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(w.Body.String(), tc.want) {
+				t.Errorf("ошибка %q не содержит %q", strings.TrimSpace(w.Body.String()), tc.want)
+			}
+		})
+	}
+
+	if w := post(s, "/zones", ""); w.Code != http.StatusOK {
+		t.Errorf("запрос с параметрами по умолчанию: ответ %d", w.Code)
+	}
+}
+
+// Повторный запрос берётся из кеша, а самый давний результат вытесняется,
+// когда кеш заполнен
+func TestServiceCache(t *testing.T) {
+	s := NewService(ServiceConfig{Workers: 1, CacheSize: 2})
+	request := func(radius string) string {
+		return `{"width": 16, "height": 16, "samples": 200, "radius": ` + radius + `}`
+	}
+	steps := []struct {
+		radius string
+		cache  string
+	}{
+		{"1e-4", "miss"},
+		{"1e-4", "hit"},
+		{"1.1e-4", "miss"},
+		{"1e-4", "hit"}, // стал недавно использованным
+		{"1.2e-4", "miss"},
+		{"1.1e-4", "miss"}, // вытеснен последним запросом
+		{"1e-4", "miss"},
+	}
+	bodies := make(map[string]string)
+	for i, step := range steps {
+		w := post(s, "/profile", request(step.radius))
+		if w.Code != http.StatusOK {
+			t.Fatalf("шаг %d: ответ %d: %s", i, w.Code, w.Body)
+		}
+		if got := w.Header().Get("X-Cache"); got != step.cache {
+			t.Errorf("шаг %d, радиус %s: X-Cache %q, ожидается %q", i, step.radius, got, step.cache)
+		}
+		if prev, ok := bodies[step.radius]; ok && prev != w.Body.String() {
+			t.Errorf("шаг %d: ответ на повторный запрос изменился", i)
+		}
+		bodies[step.radius] = w.Body.String()
+	}
+}
@@ -0,0 +1,437 @@
+// Package diffraction моделирует дифракцию Френеля на препятствиях
+// произвольной формы: сумму по точкам края (Монте-Карло или квадратуры),
+// методы БПФ, дальнюю зону Фраунгофера и аналитическое решение для диска.
+//
+// Все параметры расчёта хранятся в Simulation, поэтому несколько расчётов
+// с разными параметрами могут идти одновременно:
+//
+//	sim, err := diffraction.New(
+//		diffraction.WithWavelength(500e-9),
+//		diffraction.WithRadius(100e-6),
+//		diffraction.WithDistance(7.14e-3),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	field := sim.Field(ctx)
+//	img := sim.Image(field)
+package diffraction
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Точка на краю препятствия, её квадратурный вес и производная контура
+// (TX, TY) по параметру t, нужная непараксиальным ядрам
+type Point struct{ X, Y, W, TX, TY float64 }
+
+// Config — параметры расчёта. Длины задаются в метрах.
+type Config struct {
+	Wavelength    float64        // длина волны
+	Radius        float64        // радиус диска или основной размер препятствия
+	Distance      float64        // расстояние от препятствия до экрана
+	ScreenWidth   float64        // ширина экрана
+	Width, Height int            // размер изображения в пикселях
+	Samples       int            // количество точек на краю препятствия
+	Sampling      SamplingMethod // размещение точек на краю
+	Seed          int64          // seed генератора; 0 — взять из текущего времени
+	Kernel        Kernel         // ядро распространения
+	Obstacle      ObstacleSpec
+	Spectrum      SpectrumSpec
+	Illumination  IlluminationSpec
+	Coherence     CoherenceSpec
+	Geometry      GeometrySpec
+	Solver        SolverMethod
+	FFTGrid       int     // узлов сетки БПФ по каждой оси
+	FFTPadding    float64 // ширина сетки БПФ относительно экрана и препятствия
+	Regime        Regime
+	Radial        bool // осесимметричные задачи считаются по радиальному профилю
+	Workers       int  // потоков расчёта; 0 — по числу ядер
+	Adaptive      float64
+	AdaptiveMax   int // наибольшее количество точек края на пиксель; 0 — DefaultAdaptiveBudget·Samples
+	Normalization Normalization
+
+	Checkpoint         string        // файл контрольной точки; пусто — не сохранять
+	CheckpointInterval time.Duration // период сохранения контрольной точки
+	Remotes            []string      // адреса рабочих процессов распределённого расчёта
+
+	Log io.Writer // сообщения и прогресс; nil — не выводить
+}
+
+// Во сколько раз предел адаптивной выборки по умолчанию больше Samples
+const DefaultAdaptiveBudget = 64
+
+// DefaultConfig возвращает параметры опыта с пятном Пуассона, которые
+// программа использует по умолчанию
+func DefaultConfig() Config {
+	return Config{
+		Wavelength:         500e-9,
+		Radius:             100e-6,
+		Distance:           7.14e-3,
+		ScreenWidth:        0.5e-3,
+		Width:              800,
+		Height:             800,
+		Samples:            10000,
+		Sampling:           SamplingRandom,
+		Kernel:             KernelParaxial,
+		Obstacle:           ObstacleSpec{Kind: "disk"},
+		Spectrum:           SpectrumSpec{Kind: "mono"},
+		Illumination:       IlluminationSpec{Kind: "plane"},
+		Coherence:          CoherenceSpec{Source: "point", SourceSamples: 7, BandSamples: 5},
+		Solver:             SolverEdgeSum,
+		FFTGrid:            1024,
+		FFTPadding:         2,
+		Regime:             RegimeAuto,
+		Radial:             true,
+		Normalization:      NormalizeMax,
+		CheckpointInterval: time.Minute,
+	}
+}
+
+// Option изменяет параметры расчёта
+type Option func(*Config)
+
+// WithConfig заменяет все параметры сразу
+func WithConfig(c Config) Option { return func(cfg *Config) { *cfg = c } }
+
+func WithWavelength(m float64) Option { return func(c *Config) { c.Wavelength = m } }
+func WithRadius(m float64) Option     { return func(c *Config) { c.Radius = m } }
+func WithDistance(m float64) Option   { return func(c *Config) { c.Distance = m } }
+func WithScreen(m float64) Option     { return func(c *Config) { c.ScreenWidth = m } }
+func WithSize(w, h int) Option        { return func(c *Config) { c.Width, c.Height = w, h } }
+func WithSeed(seed int64) Option      { return func(c *Config) { c.Seed = seed } }
+func WithKernel(k Kernel) Option      { return func(c *Config) { c.Kernel = k } }
+func WithSolver(m SolverMethod) Option {
+	return func(c *Config) { c.Solver = m }
+}
+func WithObstacle(spec ObstacleSpec) Option {
+	return func(c *Config) { c.Obstacle = spec }
+}
+func WithSpectrum(spec SpectrumSpec) Option {
+	return func(c *Config) { c.Spectrum = spec }
+}
+func WithIllumination(spec IlluminationSpec) Option {
+	return func(c *Config) { c.Illumination = spec }
+}
+func WithCoherence(spec CoherenceSpec) Option {
+	return func(c *Config) { c.Coherence = spec }
+}
+func WithGeometry(spec GeometrySpec) Option {
+	return func(c *Config) { c.Geometry = spec }
+}
+func WithNormalization(n Normalization) Option {
+	return func(c *Config) { c.Normalization = n }
+}
+func WithWorkers(n int) Option   { return func(c *Config) { c.Workers = n } }
+func WithLog(w io.Writer) Option { return func(c *Config) { c.Log = w } }
+
+// WithSamples задаёт количество точек на краю и способ их размещения
+func WithSamples(n int, method SamplingMethod) Option {
+	return func(c *Config) { c.Samples, c.Sampling = n, method }
+}
+
+// WithAdaptive включает адаптивную выборку с целевой относительной ошибкой
+// target и пределом maxSamples точек на пиксель (0 — по умолчанию)
+func WithAdaptive(target float64, maxSamples int) Option {
+	return func(c *Config) { c.Adaptive, c.AdaptiveMax = target, maxSamples }
+}
+
+// WithCheckpoint сохраняет готовые плитки в файл каждые interval
+func WithCheckpoint(path string, interval time.Duration) Option {
+	return func(c *Config) { c.Checkpoint, c.CheckpointInterval = path, interval }
+}
+
+// WithRemotes раздаёт плитки рабочим процессам по адресам urls
+func WithRemotes(urls ...string) Option { return func(c *Config) { c.Remotes = urls } }
+
+// Simulation — подготовленный расчёт: параметры, препятствие, спектр
+// и точки края. После New параметры не меняются, поэтому методы можно
+// вызывать из нескольких горутин; контрольная точка рассчитана на один
+// вызов Field.
+type Simulation struct {
+	Config
+	obstacle   Obstacle
+	spectrum   []SpectralSample // nil — монохроматический источник
+	points     []Point
+	log        io.Writer
+	checkpoint *checkpointState // nil — контрольные точки не используются
+	remotes    *remotePool      // nil — плитки считаются локально
+
+	contributions    []coherentContribution // nil — освещение когерентно
+	offsetX, offsetY float64                // сдвиг картины относительно центра экрана
+	umbra            [][]bool               // общая тень вкладов; nil — пропускается вся тень
+}
+
+// New проверяет параметры и готовит расчёт: строит препятствие и спектр,
+// открывает контрольную точку, опрашивает рабочие процессы и размещает
+// точки на краю
+func New(opts ...Option) (*Simulation, error) {
+	cfg := DefaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Simulation{Config: cfg, log: cfg.Log}
+	s.offsetX, s.offsetY = cfg.patternOffset()
+	if s.log == nil {
+		s.log = io.Discard
+	}
+	if s.Workers == 0 {
+		s.Workers = runtime.NumCPU()
+	}
+	if s.AdaptiveMax == 0 {
+		s.AdaptiveMax = DefaultAdaptiveBudget * s.Samples
+	}
+	if s.Seed == 0 {
+		s.Seed = time.Now().UnixNano()
+	}
+
+	var err error
+	if s.Obstacle, err = s.Obstacle.normalized(); err != nil {
+		return nil, err
+	}
+	if s.obstacle, err = BuildObstacle(s.Obstacle, s.Radius); err != nil {
+		return nil, err
+	}
+	if s.spectrum, err = BuildSpectrum(s.Spectrum); err != nil {
+		return nil, err
+	}
+
+	if !s.Coherence.Coherent() {
+		s.contributions = cfg.coherentContributions()
+		if s.Checkpoint != "" || len(s.Remotes) > 0 {
+			s.logf("При частичной когерентности вклады считаются локально: контрольная точка и рабочие процессы не используются\n")
+			s.Checkpoint, s.Remotes = "", nil
+		}
+	}
+	if !s.Geometry.Aligned() {
+		u, v := s.SpotPosition()
+		s.logf("Центр тени на экране: (%.4g, %.4g) м от центра экрана\n", u, v)
+		if math.Abs(u) > s.ScreenWidth/2 || math.Abs(v) > s.ScreenWidth*float64(s.Height)/float64(s.Width)/2 {
+			s.logf("Внимание: центр тени и пятно Пуассона вне экрана\n")
+		}
+	}
+	if s.Normalization == NormalizePhysical && s.Solver == SolverEdgeSum && !s.boundaryWave() {
+		s.logf("Для маски и неплоской волны сумма по краю даёт I/I0 только на оси и в тени, всё поле в I/I0 считает -solver angular\n")
+	}
+	if s.Adaptive > 0 && s.Solver != SolverEdgeSum {
+		s.logf("Адаптивная выборка относится только к сумме по краю, для методов БПФ не используется\n")
+	}
+	if (s.Checkpoint != "" || len(s.Remotes) > 0) && s.Solver == SolverEdgeSum && s.radialField() {
+		// Контрольная точка и рабочие процессы работают с плитками пикселей,
+		// у радиального профиля их нет
+		s.logf("С контрольной точкой или рабочими процессами поле считается в каждом пикселе, радиальный профиль не используется\n")
+		s.Radial = false
+	}
+	if s.Checkpoint != "" {
+		if !s.tiledRender() {
+			s.logf("Контрольные точки нужны только для расчёта суммой по краю в каждом пикселе, файл не используется\n")
+		} else {
+			// Если seed не задан явно, он берётся из контрольной точки
+			if s.checkpoint, err = s.openCheckpoint(cfg.Seed != 0); err != nil {
+				return nil, err
+			}
+			s.Seed = s.checkpoint.params.Seed
+		}
+	}
+	if len(s.Remotes) > 0 {
+		if !s.tiledRender() {
+			s.logf("Распределённый расчёт нужен только для суммы по краю в каждом пикселе, считаем локально\n")
+		} else if s.remotes, err = s.connectRemotes(); err != nil {
+			return nil, err
+		}
+	}
+
+	s.logf("Метод выборки: %s, seed: %d\n", s.Sampling, s.Seed)
+	s.points = generateEdgePoints(s.obstacle, s.Samples, s.Sampling, s.Seed, s.Workers)
+	return s, nil
+}
+
+// Validate проверяет, что параметры физически осмысленны
+func (c *Config) Validate() error {
+	positive := []struct {
+		name  string
+		value float64
+	}{
+		{"длина волны", c.Wavelength},
+		{"радиус препятствия", c.Radius},
+		{"расстояние до экрана", c.Distance},
+		{"ширина экрана", c.ScreenWidth},
+	}
+	for _, p := range positive {
+		if math.IsNaN(p.value) || math.IsInf(p.value, 0) || p.value <= 0 {
+			return fmt.Errorf("%s: ожидается конечная положительная величина, получено %v", p.name, p.value)
+		}
+	}
+	if c.Wavelength >= c.Distance {
+		return fmt.Errorf("длина волны (%v м) должна быть много меньше расстояния до экрана (%v м)", c.Wavelength, c.Distance)
+	}
+	if c.Samples < 1 {
+		return fmt.Errorf("количество точек должно быть положительным, получено %d", c.Samples)
+	}
+	if c.Width < 1 || c.Height < 1 {
+		return fmt.Errorf("размер изображения должен быть положительным, получено %dx%d", c.Width, c.Height)
+	}
+	if _, err := ParseSamplingMethod(string(c.Sampling)); err != nil {
+		return err
+	}
+	if _, err := ParseKernel(string(c.Kernel)); err != nil {
+		return err
+	}
+	if c.Kernel != KernelParaxial {
+		// Интеграл по площади переходит в интеграл по краю только для плоской
+		// волны и края, обход которого известен
+		if !c.Illumination.plane() {
+			return fmt.Errorf("ядро %s поддерживается только для плоской волны", c.Kernel)
+		}
+		if strings.TrimPrefix(c.Obstacle.Kind, "~") == "mask" {
+			return fmt.Errorf("ядро %s не поддерживается для маски: у её края нет направления обхода", c.Kernel)
+		}
+	}
+	if _, err := ParseSolverMethod(string(c.Solver)); err != nil {
+		return err
+	}
+	if _, err := ParseRegime(string(c.Regime)); err != nil {
+		return err
+	}
+	if _, err := ParseNormalization(string(c.Normalization)); err != nil {
+		return err
+	}
+	if err := c.Illumination.validate(); err != nil {
+		return err
+	}
+	if c.Regime == RegimeFraunhofer && !c.Illumination.plane() {
+		return fmt.Errorf("дальняя зона рассчитывается только для плоской волны")
+	}
+	if err := c.Coherence.validate(); err != nil {
+		return err
+	}
+	if c.Coherence.Bandwidth >= c.Wavelength {
+		return fmt.Errorf("ширина спектра (%v м) должна быть меньше длины волны (%v м)", c.Coherence.Bandwidth, c.Wavelength)
+	}
+	if c.Regime == RegimeFraunhofer && !c.Coherence.Coherent() {
+		return fmt.Errorf("дальняя зона рассчитывается только для когерентного освещения")
+	}
+	if err := c.Geometry.validate(); err != nil {
+		return err
+	}
+	if c.Geometry.screenTilted() {
+		if c.Solver != SolverEdgeSum || c.Regime == RegimeFraunhofer {
+			return fmt.Errorf("повёрнутый экран поддерживается только суммой по краю в ближней зоне")
+		}
+		if z := c.nearestScreenDistance(); z <= c.Wavelength {
+			return fmt.Errorf("повёрнутый экран подходит к препятствию ближе длины волны (%v м)", z)
+		}
+	}
+	if c.Checkpoint != "" && c.CheckpointInterval <= 0 {
+		return fmt.Errorf("период сохранения контрольной точки должен быть положительным, получено %v", c.CheckpointInterval)
+	}
+	if c.Workers < 0 {
+		return fmt.Errorf("количество потоков не может быть отрицательным, получено %d", c.Workers)
+	}
+	if c.FFTGrid < 16 {
+		return fmt.Errorf("сетка БПФ должна содержать не меньше 16 узлов, получено %d", c.FFTGrid)
+	}
+	if c.FFTPadding < 1 {
+		return fmt.Errorf("запас сетки БПФ должен быть не меньше 1, получено %g", c.FFTPadding)
+	}
+	if c.Adaptive < 0 || c.Adaptive >= 1 {
+		return fmt.Errorf("целевая ошибка адаптивной выборки должна быть в [0, 1), получено %g", c.Adaptive)
+	}
+	if c.Adaptive > 0 && (c.Sampling == SamplingUniform || c.Sampling == SamplingGauss) {
+		// Детерминированная сетка на каждом уровне повторяет те же точки и ошибку не уменьшает
+		return fmt.Errorf("адаптивная выборка возможна только со случайными точками края (random или stratified), получено %s", c.Sampling)
+	}
+	if c.AdaptiveMax != 0 && c.AdaptiveMax < c.Samples {
+		return fmt.Errorf("предел адаптивной выборки (%d) меньше начального количества точек (%d)", c.AdaptiveMax, c.Samples)
+	}
+	return nil
+}
+
+func (s *Simulation) logf(format string, args ...any) {
+	fmt.Fprintf(s.log, format, args...)
+}
+
+// Shape возвращает построенное препятствие
+func (s *Simulation) Shape() Obstacle { return s.obstacle }
+
+// Points возвращает точки края, по которым считается амплитуда
+func (s *Simulation) Points() []Point { return s.points }
+
+// Polychromatic сообщает, задан ли спектр источника из нескольких длин волн
+func (s *Simulation) Polychromatic() bool { return s.spectrum != nil }
+
+// FresnelZones возвращает количество открытых зон Френеля m = r²/(λz);
+// для точечного источника и гауссова пучка — с учётом кривизны волны
+func (c *Config) FresnelZones() float64 {
+	return c.fresnelZonesAt(c.Wavelength)
+}
+
+// Amplitude возвращает комплексную амплитуду в точке экрана (x, y), м.
+// Координаты отсчитываются от оси, проходящей через центр препятствия
+// вдоль падающей волны, на неповёрнутом экране.
+func (s *Simulation) Amplitude(x, y float64) (float64, float64) {
+	re, im, _ := s.AmplitudeWithError(x, y)
+	return re, im
+}
+
+// AmplitudeWithError дополнительно возвращает стандартную ошибку
+// интенсивности: точки разбиваются на errorBatches независимых пакетов
+// (точка i попадает в пакет i % errorBatches), и разброс пакетных
+// амплитуд переносится на интенсивность |A|² линеаризацией.
+func (s *Simulation) AmplitudeWithError(x, y float64) (float64, float64, float64) {
+	return s.amplitudeAtWavelength(s.points, x, y, s.Wavelength)
+}
+
+// Intensity возвращает интенсивность в точке экрана (x, y), м. При
+// частичной когерентности это взвешенная сумма интенсивностей вкладов,
+// а Amplitude остаётся амплитудой точечного источника на длине волны
+// Wavelength.
+func (s *Simulation) Intensity(x, y float64) float64 {
+	intens, _ := s.intensityWithError(x, y)
+	return intens
+}
+
+// ProfilePoint — отсчёт профиля интенсивности
+type ProfilePoint struct {
+	X         float64 `json:"x"` // расстояние вдоль линии профиля, м (см. ProfileAlong)
+	Intensity float64 `json:"intensity"`
+	StdErr    float64 `json:"std_err"`
+}
+
+// Profile считает интенсивность вдоль центральной горизонтальной линии
+// экрана, по отсчёту на каждый столбец пикселей
+func (s *Simulation) Profile(ctx context.Context) ([]ProfilePoint, error) {
+	return s.ProfileAlong(ctx, ProfileSpec{})
+}
+
+// screenPosition переводит пиксель в координаты на экране (в метрах).
+// При наклонённой волне или смещённом экране это точка картины соосной
+// установки, попадающая в пиксель.
+func (s *Simulation) screenPosition(x, y int, scale float64) (float64, float64) {
+	return s.screenPoint((float64(x)-float64(s.Width)/2)*scale, (float64(y)-float64(s.Height)/2)*scale)
+}
+
+// shadowCenter возвращает пиксель центра тени, вокруг которого рисуется
+// пятно Пуассона
+func (s *Simulation) shadowCenter(scale float64) (int, int) {
+	u, v := s.SpotPosition()
+	return s.Width/2 + int(math.Round(u/scale)), s.Height/2 + int(math.Round(v/scale))
+}
+
+// CheckParaxial предупреждает, если для параксиального ядра отброшенный
+// член разложения фазы слишком велик
+func (s *Simulation) CheckParaxial() {
+	if s.Kernel == KernelParaxial {
+		s.checkParaxialValidity(2*math.Pi/s.Wavelength, s.Distance, s.Radius, s.ScreenWidth/math.Sqrt2)
+	}
+}
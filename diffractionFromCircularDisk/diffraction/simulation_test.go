@@ -0,0 +1,128 @@
+package diffraction
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+)
+
+// testSimulation создаёт расчёт небольшого экрана с фиксированным seed
+func testSimulation(t *testing.T, opts ...Option) *Simulation {
+	t.Helper()
+	sim, err := New(append([]Option{
+		WithSize(32, 32),
+		WithSamples(2000, SamplingRandom),
+		WithSeed(1),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+// На оси за диском в параксиальном приближении I = I0 (пятно Араго — Пуассона)
+func TestDiskAxisIntensity(t *testing.T) {
+	sim := testSimulation(t, WithSamples(20000, SamplingRandom), WithNormalization(NormalizePhysical))
+	if got := sim.Intensity(0, 0); math.Abs(got-1) > 0.02 {
+		t.Errorf("интенсивность на оси за диском: I/I0 = %.4f, ожидается 1", got)
+	}
+}
+
+// Поле при фиксированном seed не зависит от количества потоков
+func TestFieldIndependentOfWorkers(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []Option
+	}{
+		{"edge", []Option{func(c *Config) { c.Radial = false }}},
+		{"radial", nil},
+		{"adaptive", []Option{func(c *Config) { c.Radial = false }, WithAdaptive(0.05, 8000)}},
+		{"polygon", []Option{WithObstacle(ObstacleSpec{Kind: "polygon", Sides: 6})}},
+	}
+	ctx := context.Background()
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			one := testSimulation(t, append(tc.opts, WithWorkers(1))...).Field(ctx)
+			four := testSimulation(t, append(tc.opts, WithWorkers(4))...).Field(ctx)
+			for y := range one.Intensity {
+				for x := range one.Intensity[y] {
+					if a, b := one.Intensity[y][x], four.Intensity[y][x]; a != b {
+						t.Fatalf("пиксель (%d, %d): %g при 1 потоке и %g при 4", x, y, a, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"отрицательная длина волны", func(c *Config) { c.Wavelength = -500e-9 }, "длина волны"},
+		{"длина волны NaN", func(c *Config) { c.Wavelength = math.NaN() }, "длина волны"},
+		{"нулевой радиус", func(c *Config) { c.Radius = 0 }, "радиус препятствия"},
+		{"длина волны больше расстояния", func(c *Config) { c.Wavelength = 1 }, "много меньше"},
+		{"нет точек", func(c *Config) { c.Samples = 0 }, "количество точек"},
+		{"пустое изображение", func(c *Config) { c.Width = 0 }, "размер изображения"},
+		{"неизвестная выборка", func(c *Config) { c.Sampling = "sobol" }, "sobol"},
+		{"неизвестное ядро", func(c *Config) { c.Kernel = "exact" }, "exact"},
+		{"неизвестный метод", func(c *Config) { c.Solver = "spectral" }, "spectral"},
+		{"неизвестная нормировка", func(c *Config) { c.Normalization = "peak" }, "peak"},
+		{"отрицательные потоки", func(c *Config) { c.Workers = -1 }, "потоков"},
+		{"адаптивная выборка с gauss", func(c *Config) { c.Adaptive, c.Sampling = 0.01, SamplingGauss }, "адаптивн"},
+		{"адаптивная выборка с uniform", func(c *Config) { c.Adaptive, c.Sampling = 0.01, SamplingUniform }, "адаптивн"},
+		{"ошибка адаптивной выборки больше 1", func(c *Config) { c.Adaptive = 1.5 }, "адаптивн"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := DefaultConfig()
+			tc.modify(&c)
+			err := c.Validate()
+			if err == nil {
+				t.Fatalf("ожидалась ошибка проверки параметров")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("ошибка %q не содержит %q", err, tc.want)
+			}
+		})
+	}
+
+	c := DefaultConfig()
+	if err := c.Validate(); err != nil {
+		t.Errorf("параметры по умолчанию не прошли проверку: %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	parsers := []struct {
+		name  string
+		parse func(string) error
+		valid string
+	}{
+		{"ParseKernel", func(s string) error { _, err := ParseKernel(s); return err }, string(KernelParaxial)},
+		{"ParseSamplingMethod", func(s string) error { _, err := ParseSamplingMethod(s); return err }, string(SamplingRandom)},
+		{"ParseSolverMethod", func(s string) error { _, err := ParseSolverMethod(s); return err }, string(SolverEdgeSum)},
+		{"ParseRegime", func(s string) error { _, err := ParseRegime(s); return err }, string(RegimeAuto)},
+		{"ParseNormalization", func(s string) error { _, err := ParseNormalization(s); return err }, string(NormalizePhysical)},
+		{"ParseObstacleKind", func(s string) error { _, err := ParseObstacleKind(s); return err }, "~polygon"},
+		{"ParseProfileKind", func(s string) error { _, err := ParseProfileKind(s); return err }, string(ProfileRadial)},
+		{"ParseOverlay", func(s string) error { _, err := ParseOverlay(s); return err }, string(OverlayNone)},
+	}
+	for _, p := range parsers {
+		if err := p.parse(p.valid); err != nil {
+			t.Errorf("%s(%q): неожиданная ошибка %v", p.name, p.valid, err)
+		}
+		for _, bad := range []string{"unknown", " " + p.valid} {
+			err := p.parse(bad)
+			if err == nil {
+				t.Errorf("%s(%q): ожидалась ошибка", p.name, bad)
+			} else if !strings.Contains(err.Error(), bad) {
+				t.Errorf("%s(%q): ошибка %q не называет значение", p.name, bad, err)
+			}
+		}
+	}
+}
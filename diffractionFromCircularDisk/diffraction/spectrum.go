@@ -0,0 +1,270 @@
+package diffraction
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// Видимый диапазон для спектра чёрного тела, в метрах
+const (
+	visibleMin = 380e-9
+	visibleMax = 780e-9
+)
+
+// Физические постоянные для формулы Планка
+const (
+	planckH   = 6.62607015e-34
+	lightC    = 299792458.0
+	boltzmann = 1.380649e-23
+)
+
+// SpectralSample — одна длина волны спектра и её вклад (сумма вкладов равна 1)
+type SpectralSample struct {
+	Lambda float64
+	Weight float64
+}
+
+// SpectrumSpec описывает спектр источника
+type SpectrumSpec struct {
+	Kind        string  `yaml:"kind" json:"kind"`                         // mono, blackbody, led, lines
+	Temperature float64 `yaml:"temperature" json:"temperature,omitempty"` // температура чёрного тела, К
+	Count       int     `yaml:"count" json:"count,omitempty"`             // число длин волн для чёрного тела
+	TablePath   string  `yaml:"table" json:"table,omitempty"`             // таблица спектра светодиода: длина волны в нм и мощность
+	Lines       string  `yaml:"lines" json:"lines,omitempty"`             // лазерные линии: "532,633:0.5" (нм[:мощность])
+}
+
+// BuildSpectrum строит нормированный набор длин волн; для mono возвращает nil
+func BuildSpectrum(spec SpectrumSpec) ([]SpectralSample, error) {
+	var s []SpectralSample
+	switch spec.Kind {
+	case "", "mono":
+		return nil, nil
+	case "blackbody":
+		if spec.Temperature <= 0 {
+			return nil, fmt.Errorf("температура чёрного тела должна быть положительной")
+		}
+		if spec.Count < 2 {
+			return nil, fmt.Errorf("для спектра нужно не меньше 2 длин волн")
+		}
+		step := (visibleMax - visibleMin) / float64(spec.Count-1)
+		for i := 0; i < spec.Count; i++ {
+			wl := visibleMin + float64(i)*step
+			s = append(s, SpectralSample{Lambda: wl, Weight: planck(wl, spec.Temperature) * step})
+		}
+	case "led":
+		table, err := readSpectrumTable(spec.TablePath)
+		if err != nil {
+			return nil, err
+		}
+		// Веса по правилу трапеций на неравномерной сетке
+		for i, row := range table {
+			lo, hi := row.Lambda, row.Lambda
+			if i > 0 {
+				lo = (table[i-1].Lambda + row.Lambda) / 2
+			}
+			if i < len(table)-1 {
+				hi = (row.Lambda + table[i+1].Lambda) / 2
+			}
+			s = append(s, SpectralSample{Lambda: row.Lambda, Weight: row.Weight * (hi - lo)})
+		}
+	case "lines":
+		for _, field := range strings.Split(spec.Lines, ",") {
+			nm, power, found := strings.Cut(strings.TrimSpace(field), ":")
+			wl, err := strconv.ParseFloat(nm, 64)
+			if err != nil {
+				return nil, fmt.Errorf("неверная длина волны %q", nm)
+			}
+			p := 1.0
+			if found {
+				if p, err = strconv.ParseFloat(power, 64); err != nil {
+					return nil, fmt.Errorf("неверная мощность линии %q", power)
+				}
+			}
+			s = append(s, SpectralSample{Lambda: wl * 1e-9, Weight: p})
+		}
+	default:
+		return nil, fmt.Errorf("неизвестный спектр %q (ожидается mono, blackbody, led или lines)", spec.Kind)
+	}
+
+	var total float64
+	for _, sample := range s {
+		if sample.Lambda <= 0 || sample.Weight < 0 {
+			return nil, fmt.Errorf("длины волн должны быть положительными, а мощности — неотрицательными")
+		}
+		total += sample.Weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("суммарная мощность спектра равна нулю")
+	}
+	for i := range s {
+		s[i].Weight /= total
+	}
+	return s, nil
+}
+
+// planck — спектральная плотность излучения чёрного тела
+func planck(wl, t float64) float64 {
+	return 2 * planckH * lightC * lightC / math.Pow(wl, 5) / math.Expm1(planckH*lightC/(wl*boltzmann*t))
+}
+
+// readSpectrumTable читает таблицу "длина волны (нм), мощность".
+// Пустые строки, строки с # и заголовки пропускаются.
+func readSpectrumTable(filename string) ([]SpectralSample, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var table []SpectralSample
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ';' || r == ' ' || r == '\t' })
+		if len(fields) < 2 {
+			continue
+		}
+		nm, err1 := strconv.ParseFloat(fields[0], 64)
+		power, err2 := strconv.ParseFloat(fields[1], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		table = append(table, SpectralSample{Lambda: nm * 1e-9, Weight: power})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(table) == 0 {
+		return nil, fmt.Errorf("в таблице %s нет данных", filename)
+	}
+
+	sort.Slice(table, func(i, j int) bool { return table[i].Lambda < table[j].Lambda })
+	return table, nil
+}
+
+// cieMatch — функции сложения цветов CIE 1931 в многолепестковой
+// гауссовой аппроксимации (Wyman, Sloan, Shirley, 2013); wl в метрах
+func cieMatch(wl float64) (float64, float64, float64) {
+	nm := wl * 1e9
+	g := func(mu, s1, s2 float64) float64 {
+		s := s1
+		if nm >= mu {
+			s = s2
+		}
+		t := (nm - mu) / s
+		return math.Exp(-t * t / 2)
+	}
+	x := 1.056*g(599.8, 37.9, 31.0) + 0.362*g(442.0, 16.0, 26.7) - 0.065*g(501.1, 20.4, 26.2)
+	y := 0.821*g(568.8, 46.9, 40.5) + 0.286*g(530.9, 16.3, 31.1)
+	z := 1.217*g(437.0, 11.8, 36.0) + 0.681*g(459.0, 26.0, 13.8)
+	return x, y, z
+}
+
+// xyzToSRGB переводит XYZ (D65) в 8-битный sRGB с гамма-коррекцией
+func xyzToSRGB(x, y, z float64) color.RGBA {
+	gamma := func(c float64) uint8 {
+		c = math.Min(1, math.Max(0, c))
+		if c <= 0.0031308 {
+			c *= 12.92
+		} else {
+			c = 1.055*math.Pow(c, 1/2.4) - 0.055
+		}
+		return uint8(math.Round(255 * c))
+	}
+	r := 3.2406*x - 1.5372*y - 0.4986*z
+	g := -0.9689*x + 1.8758*y + 0.0415*z
+	b := 0.0557*x - 0.2040*y + 1.0570*z
+	return color.RGBA{gamma(r), gamma(g), gamma(b), 255}
+}
+
+// atWavelength возвращает расчёт той же установки на длине волны wl:
+// тот же метод, точки края, смещение картины и источник. Контрольная
+// точка, рабочие процессы и сообщения не используются.
+func (s *Simulation) atWavelength(wl float64) *Simulation {
+	sub := s.contribution(coherentContribution{wavelength: wl, weight: 1}, s.Workers, s.umbra)
+	if s.contributions != nil {
+		// Протяжённый источник и полоса вокруг wl, а не вокруг Wavelength
+		sub.contributions = sub.coherentContributions()
+	}
+	return sub
+}
+
+// SpectralImage интегрирует интенсивность по спектру источника
+// с весами функций сложения цветов и переводит её в sRGB. Поле на каждой
+// длине волны считается тем же путём, что и Field: выбранным методом,
+// с частичной когерентностью и смещением картины. Тень препятствия
+// остаётся чёрной, кроме пятна Пуассона, как в RenderImage. Яркость
+// нормируется так, что самый яркий пиксель вне тени имеет Y = 1.
+// Для монохроматического источника возвращает nil. После отмены ctx
+// возвращается изображение по уже посчитанным длинам волн и ошибка контекста.
+func (s *Simulation) SpectralImage(ctx context.Context) (*image.RGBA, error) {
+	if s.spectrum == nil {
+		return nil, nil
+	}
+	xyz := make([][][3]float64, s.Height)
+	for y := range xyz {
+		xyz[y] = make([][3]float64, s.Width)
+	}
+	var opaque [][]bool
+
+	bar := progressbar.NewOptions(
+		len(s.spectrum),
+		progressbar.OptionSetWriter(s.log),
+		progressbar.OptionSetDescription("Длины волн..."),
+		progressbar.OptionSetWidth(30),
+	)
+
+	var err error
+	for _, sample := range s.spectrum {
+		field := s.atWavelength(sample.Lambda).Field(ctx)
+		if field.Partial {
+			err = ctx.Err()
+			break
+		}
+		x, y, z := cieMatch(sample.Lambda)
+		cmf := [3]float64{sample.Weight * x, sample.Weight * y, sample.Weight * z}
+		for py := range xyz {
+			for px := range xyz[py] {
+				for c := range 3 {
+					xyz[py][px][c] += field.Intensity[py][px] * cmf[c]
+				}
+			}
+		}
+		opaque = field.Opaque
+		_ = bar.Add(1)
+	}
+
+	// Пятно Пуассона, как и в Field, в максимум яркости не входит
+	var maxY float64
+	for y := range xyz {
+		for x := range xyz[y] {
+			if opaque != nil && !opaque[y][x] {
+				maxY = math.Max(maxY, xyz[y][x][1])
+			}
+		}
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+	for y := range xyz {
+		for x, c := range xyz[y] {
+			img.Set(x, y, xyzToSRGB(c[0]/maxY, c[1]/maxY, c[2]/maxY))
+		}
+	}
+	return img, err
+}
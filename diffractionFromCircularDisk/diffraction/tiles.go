@@ -0,0 +1,230 @@
+package diffraction
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// Сторона квадратной плитки изображения в пикселях. Плитки мелкие, чтобы
+// потоки, попавшие на тень препятствия, сразу брали следующую работу.
+const tileSize = 32
+
+// Прямоугольник пикселей [X0, X1) × [Y0, Y1)
+type tile struct{ X0, Y0, X1, Y1 int }
+
+func (t tile) pixels() int { return (t.X1 - t.X0) * (t.Y1 - t.Y0) }
+
+// makeTiles разбивает изображение на плитки построчно
+func makeTiles(width, height, size int) []tile {
+	var tiles []tile
+	for y := 0; y < height; y += size {
+		for x := 0; x < width; x += size {
+			tiles = append(tiles, tile{X0: x, Y0: y, X1: min(x+size, width), Y1: min(y+size, height)})
+		}
+	}
+	return tiles
+}
+
+// Посчитанные значения плитки, построчно; в тени — нули
+type tileResult struct {
+	Intensity, StdErr, Re, Im []float64
+	Samples                   []int // точек края на пиксель
+}
+
+// computeTile считает сумму по краю во всех пикселях плитки вне тени,
+// переходя к следующему уровню выборки, пока ошибка не достигнет цели
+func (s *Simulation) computeTile(levels [][]Point, t tile) tileResult {
+	r, _ := s.computeTileContext(context.Background(), levels, t)
+	return r
+}
+
+// computeTileContext — то же, что computeTile, но после отмены ctx
+// плитка не досчитывается и возвращается ошибка контекста
+func (s *Simulation) computeTileContext(ctx context.Context, levels [][]Point, t tile) (tileResult, error) {
+	scale := s.ScreenWidth / float64(s.Width)
+	n := t.pixels()
+	r := tileResult{
+		Intensity: make([]float64, n),
+		StdErr:    make([]float64, n),
+		Re:        make([]float64, n),
+		Im:        make([]float64, n),
+		Samples:   make([]int, n),
+	}
+	i := 0
+	for y := t.Y0; y < t.Y1; y++ {
+		for x := t.X0; x < t.X1; x++ {
+			xPos, yPos := s.screenPosition(x, y, scale)
+			if !s.skipShadow(x, y, s.obstacle.Opaque(xPos, yPos)) {
+				if err := ctx.Err(); err != nil {
+					return r, err
+				}
+				re, im, se, used := s.adaptiveAmplitude(levels, xPos, yPos) // действительные и мнимые части амплитуды
+				r.Intensity[i] = re*re + im*im
+				r.StdErr[i] = se
+				r.Re[i], r.Im[i] = re, im
+				r.Samples[i] = used
+			}
+			i++
+		}
+	}
+	return r, nil
+}
+
+// storeTile копирует значения плитки в поле и возвращает их максимум вне тени
+func (field *Field) storeTile(t tile, r tileResult) float64 {
+	var maxI float64
+	i := 0
+	for y := t.Y0; y < t.Y1; y++ {
+		for x := t.X0; x < t.X1; x++ {
+			field.Intensity[y][x] = r.Intensity[i]
+			field.StdErr[y][x] = r.StdErr[i]
+			field.Re[y][x], field.Im[y][x] = r.Re[i], r.Im[i]
+			if field.SamplesUsed != nil {
+				field.SamplesUsed[y][x] = r.Samples[i]
+			}
+			if !field.Opaque[y][x] {
+				maxI = math.Max(maxI, r.Intensity[i])
+			}
+			i++
+		}
+	}
+	return maxI
+}
+
+// loadTile возвращает значения плитки из поля
+func (field *Field) loadTile(t tile) tileResult {
+	var r tileResult
+	for y := t.Y0; y < t.Y1; y++ {
+		r.Intensity = append(r.Intensity, field.Intensity[y][t.X0:t.X1]...)
+		r.StdErr = append(r.StdErr, field.StdErr[y][t.X0:t.X1]...)
+		r.Re = append(r.Re, field.Re[y][t.X0:t.X1]...)
+		r.Im = append(r.Im, field.Im[y][t.X0:t.X1]...)
+		if field.SamplesUsed != nil {
+			r.Samples = append(r.Samples, field.SamplesUsed[y][t.X0:t.X1]...)
+		} else {
+			r.Samples = append(r.Samples, make([]int, t.X1-t.X0)...)
+		}
+	}
+	return r
+}
+
+// Плитки изображения и отметки о готовности. Данные готовой плитки больше
+// не меняются, поэтому их можно читать, увидев отметку под мьютексом.
+type tileSet struct {
+	tiles []tile
+	mu    sync.Mutex
+	done  []bool
+}
+
+func newTileSet(tiles []tile) *tileSet {
+	return &tileSet{tiles: tiles, done: make([]bool, len(tiles))}
+}
+
+// completed возвращает номера готовых плиток
+func (s *tileSet) completed() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var idx []int
+	for i, d := range s.done {
+		if d {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// renderTiles раздаёт неготовые плитки concurrency потокам по мере освобождения
+// и показывает прогресс в пикселях в секунду. После отмены ctx новые плитки
+// не берутся, уже начатые дорисовываются. Плитка считается готовой, если fn
+// вернула true. Возвращает ошибку контекста, если расчёт прерван.
+func (s *Simulation) renderTiles(ctx context.Context, set *tileSet, concurrency int, fn func(t tile) bool) error {
+	// Плитки из контрольной точки не входят в прогресс, иначе завысилась бы скорость
+	remaining := 0
+	queue := make(chan int, len(set.tiles))
+	for i, t := range set.tiles {
+		if !set.done[i] {
+			remaining += t.pixels()
+			queue <- i
+		}
+	}
+	close(queue)
+
+	bar := progressbar.NewOptions(
+		remaining,
+		progressbar.OptionSetWriter(s.log),
+		progressbar.OptionSetDescription("Обработка пикселей..."),
+		progressbar.OptionSetWidth(30),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetItsString("пикс"),
+		progressbar.OptionThrottle(100*time.Millisecond),
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if ctx.Err() != nil || !fn(set.tiles[i]) {
+					return
+				}
+				set.mu.Lock()
+				set.done[i] = true
+				set.mu.Unlock()
+				_ = bar.Add(set.tiles[i].pixels())
+			}
+		}()
+	}
+	wg.Wait()
+	s.logf("\n")
+	return ctx.Err()
+}
+
+// parallelRows выполняет fn для строк 0..n-1 в Workers потоках
+func (s *Simulation) parallelRows(n int, fn func(y int)) {
+	_ = s.parallelRowsContext(context.Background(), n, fn)
+}
+
+// parallelRowsContext — то же, что parallelRows, но после отмены ctx
+// новые строки не берутся, уже начатые досчитываются. Возвращает ошибку
+// контекста, если часть строк пропущена.
+func (s *Simulation) parallelRowsContext(ctx context.Context, n int, fn func(y int)) error {
+	rows := make(chan int, n)
+	for y := 0; y < n; y++ {
+		rows <- y
+	}
+	close(rows)
+
+	var skipped atomic.Bool
+	var wg sync.WaitGroup
+	for w := 0; w < s.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				if ctx.Err() != nil {
+					skipped.Store(true)
+					return
+				}
+				fn(y)
+			}
+		}()
+	}
+	wg.Wait()
+	if skipped.Load() {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// tiledRender сообщает, будет ли поле считаться суммой по краю в каждом
+// пикселе по плиткам — только такой расчёт сохраняется в контрольных
+// точках и раздаётся рабочим процессам
+func (s *Simulation) tiledRender() bool {
+	return s.Solver == SolverEdgeSum && !s.radialField()
+}
@@ -0,0 +1,119 @@
+package diffraction
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Количество независимых пакетов точек для оценки погрешности
+const errorBatches = 16
+
+// Пиксели темнее этой доли максимума не учитываются в относительной ошибке,
+// иначе в тёмных кольцах она уходит в бесконечность
+const relativeErrorThreshold = 0.01
+
+// Целевая относительная ошибка для подсказки о количестве точек
+const targetRelativeError = 0.01
+
+// intensityStdErr оценивает стандартную ошибку I = re² + im² по суммам
+// nb пакетов. Оценка краевой суммы по пакету — его сумма, пересчитанная
+// на полный вес: batch * W / batchW; её среднее равно (sumRe, sumIm).
+func intensityStdErr(batchRe, batchIm, batchW []float64, sumRe, sumIm, re, im float64, nb int) float64 {
+	if nb < 2 {
+		return 0
+	}
+
+	var total float64
+	for b := 0; b < nb; b++ {
+		total += batchW[b]
+	}
+
+	n := float64(nb)
+	var varRe, varIm, cov float64
+	for b := 0; b < nb; b++ {
+		scale := total / batchW[b]
+		dRe := scale*batchRe[b] - sumRe
+		dIm := scale*batchIm[b] - sumIm
+		varRe += dRe * dRe
+		varIm += dIm * dIm
+		cov += dRe * dIm
+	}
+	varRe /= n - 1
+	varIm /= n - 1
+	cov /= n - 1
+
+	// Дисперсия среднего по пакетам, перенесённая через градиент (2re, 2im)
+	v := 4 * (re*re*varRe + im*im*varIm + 2*re*im*cov) / n
+	return math.Sqrt(math.Max(v, 0))
+}
+
+// UncertaintyImage рисует карту стандартной ошибки интенсивности,
+// нормированную на её максимум
+func (s *Simulation) UncertaintyImage(field *Field) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, s.Width, s.Height))
+
+	var maxErr float64
+	for y := range field.StdErr {
+		for _, se := range field.StdErr[y] {
+			maxErr = math.Max(maxErr, se)
+		}
+	}
+	if maxErr == 0 {
+		maxErr = 1
+	}
+
+	for y := 0; y < s.Height; y++ {
+		for x := 0; x < s.Width; x++ {
+			img.Set(x, y, heatColor(field.StdErr[y][x]/maxErr))
+		}
+	}
+	return img
+}
+
+// heatColor переводит значение [0...1] в шкалу чёрный-красный-жёлтый-белый
+func heatColor(v float64) color.RGBA {
+	clamp := func(c float64) uint8 {
+		return uint8(255 * math.Min(1, math.Max(0, c)))
+	}
+	return color.RGBA{clamp(3 * v), clamp(3*v - 1), clamp(3*v - 2), 255}
+}
+
+// PrintErrorSummary выводит сводку по сходимости: максимальную и среднюю
+// относительную ошибку по освещённым пикселям и ошибку в центре экрана
+func (s *Simulation) PrintErrorSummary(field *Field) {
+	var maxRel, sumRel float64
+	count := 0
+	for y := range field.Intensity {
+		for x, intens := range field.Intensity[y] {
+			if field.Opaque[y][x] || intens <= 0 || intens < relativeErrorThreshold*field.MaxIntensity {
+				continue
+			}
+			rel := field.StdErr[y][x] / intens
+			maxRel = math.Max(maxRel, rel)
+			sumRel += rel
+			count++
+		}
+	}
+	meanRel := 0.0
+	if count > 0 {
+		meanRel = sumRel / float64(count)
+	}
+
+	re, im, se := s.AmplitudeWithError(0, 0)
+	centerIntensity := re*re + im*im
+	centerRel := 0.0
+	if centerIntensity > 0 {
+		centerRel = se / centerIntensity
+	}
+
+	s.logf("Максимальная относительная ошибка интенсивности: %.2f%%\n", 100*maxRel)
+	s.logf("Средняя относительная ошибка интенсивности: %.2f%%\n", 100*meanRel)
+	s.logf("Ошибка в центре экрана: %.6f (%.2f%%)\n", se, 100*centerRel)
+
+	// Для случайной выборки ошибка убывает как 1/sqrt(N)
+	if s.Sampling == SamplingRandom && meanRel > targetRelativeError {
+		needed := float64(len(s.points)) * math.Pow(meanRel/targetRelativeError, 2)
+		s.logf("Для средней ошибки %.0f%% потребуется около %.0f точек\n", 100*targetRelativeError, math.Ceil(needed))
+	}
+}
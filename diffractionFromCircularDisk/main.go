@@ -2,77 +2,155 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
 	"image"
-	"image/color"
 	"image/png"
+	"io"
 	"log"
-	"math"
-	"math/rand"
 	"os"
-	"runtime"
-	"sync"
-	"sync/atomic"
+	"os/signal"
 	"time"
 
-	"github.com/schollz/progressbar/v3"
 	"gonum.org/v1/plot"
-	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/vg"
-)
 
-const (
-	imgWidth  = 800
-	imgHeight = 800
+	"project2/diffraction"
 )
 
-type Point struct{ X, Y float64 }
+func main() {
+	cfg, interactive, err := parseCommandLine(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if interactive {
+		promptConfig(&cfg)
+	}
+	if cfg.Distributed.Listen != "" {
+		// Параметры расчёта рабочий процесс получает от координатора
+		log.Fatal(diffraction.ServeWorker(cfg.Distributed.Listen, cfg.Workers, os.Stdout))
+	}
+	if cfg.Service.Listen != "" {
+		// Параметры расчётов приходят в запросах
+		if cfg.Service.Concurrency < 1 || cfg.Service.Cache < 1 {
+			log.Fatal("количество одновременных расчётов и размер кеша сервиса должны быть положительными")
+		}
+		log.Fatal(diffraction.ServeSimulations(cfg.Service.Listen, diffraction.ServiceConfig{
+			Workers:     cfg.Workers,
+			Concurrency: cfg.Service.Concurrency,
+			CacheSize:   cfg.Service.Cache,
+			Log:         os.Stdout,
+		}))
+	}
+	if err := cfg.validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.createOutputDirs(); err != nil {
+		log.Fatal(err)
+	}
+	// Первое прерывание (Ctrl-C) останавливает расчёт с сохранением
+	// готовой части, второе завершает программу сразу
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-var (
-	lambda      float64
-	diskRadius  float64
-	distance    float64
-	samples     int
-	screenWidth float64
-)
+	if len(cfg.Sweep.Params) > 0 {
+		runSweep(ctx, cfg)
+		return
+	}
 
-func main() {
-	fmt.Print("Введите длину волны (в метрах, например 500e-9): ")
-	fmt.Scan(&lambda)
-	fmt.Print("Введите радиус диска (в метрах, например 100e-6): ")
-	fmt.Scan(&diskRadius)
-	fmt.Print("Введите расстояние до экрана (в метрах, например 7.14e-3): ")
-	fmt.Scan(&distance)
-	fmt.Print("Введите количество точек на краю диска (например 10000): ")
-	fmt.Scan(&samples)
-	fmt.Print("Введите ширину экрана (в метрах, например 0.5e-3): ")
-	fmt.Scan(&screenWidth)
+	simCfg := cfg.simulationConfig()
+	fmt.Printf("Количество открытых зон Френеля: m = %.2f\n", simCfg.FresnelZones())
+	if simCfg.ChooseRegime(os.Stdout) == diffraction.RegimeFraunhofer {
+		simCfg.Checkpoint, simCfg.Remotes = "", nil
+		runFarField(cfg, simCfg)
+		return
+	}
+	if cfg.Benchmark {
+		// Сравнение методов всегда считается локально и заново
+		simCfg.Checkpoint, simCfg.Remotes = "", nil
+	}
 
 	start := time.Now()
 
 	fmt.Println("Генерация точек...")
 	startPoints := time.Now()
-	edgePoints := generateDiskEdgePoints(samples, diskRadius)
+	sim, err := diffraction.New(diffraction.WithConfig(simCfg))
+	if err != nil {
+		log.Fatal(err)
+	}
 	fmt.Printf("Генерация точек заняла: %v\n", time.Since(startPoints))
+	sim.CheckParaxial()
+
+	if cfg.Benchmark {
+		sim.Benchmark(ctx)
+		return
+	}
 
-	fmt.Println("Создание изображения... \n")
+	fmt.Println("Создание изображения...")
 	startImage := time.Now()
-	createPoissonEffectImage(edgePoints, "poisson_effect.png")
-	fmt.Printf("\nСоздание изображения заняло: %v\n", time.Since(startImage))
+	field := sim.Field(ctx)
+	saveImage(sim.Image(field), cfg.Output.Image)
+	fmt.Printf("Создание изображения заняло: %v\n", time.Since(startImage))
+	if field.Partial {
+		fmt.Printf("Расчёт прерван, частичное изображение сохранено в %s\n", cfg.Output.Image)
+		return
+	}
+
+	if err := sim.ExportField(field, cfg.Output.Field, cfg.Output.Export, cfg.Output.Complex); err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.Output.Phase {
+		phaseImg, domainImg := sim.PhaseImages(field)
+		saveImage(phaseImg, cfg.Output.PhaseMap)
+		saveImage(domainImg, cfg.Output.DomainColoring)
+		savePlot(must(sim.PhasePlot()), cfg.Output.PhasePlot)
+	}
+
+	// У методов БПФ нет статистической ошибки
+	if sim.Solver == diffraction.SolverEdgeSum {
+		saveImage(sim.UncertaintyImage(field), cfg.Output.Uncertainty)
+		sim.PrintErrorSummary(field)
+	}
+	if field.SamplesUsed != nil {
+		saveImage(sim.SamplesImage(field), cfg.Output.SamplesMap)
+		sim.PrintSamplesSummary(field)
+	}
+
+	if sim.Polychromatic() {
+		fmt.Println("Создание цветного изображения по спектру источника...")
+		startSpectral := time.Now()
+		img, err := sim.SpectralImage(ctx)
+		saveImage(img, cfg.Output.Spectral)
+		fmt.Printf("\nСоздание цветного изображения заняло: %v\n", time.Since(startSpectral))
+		if err != nil {
+			fmt.Printf("Расчёт прерван, частичное цветное изображение сохранено в %s\n", cfg.Output.Spectral)
+			return
+		}
+	}
 
 	fmt.Println("Создание графика интенсивности...")
 	startPlot := time.Now()
-	createIntensityPlot(edgePoints, "intensity_plot.png")
+	savePlot(must(sim.ProfilePlot(cfg.Plot.spec())), cfg.Output.Plot)
 	fmt.Printf("Создание графика заняло: %v\n", time.Since(startPlot))
 
-	calculateFresnelZones(diskRadius, lambda, distance)
+	compareWithReference(sim, field, cfg.Output.AccuracyPlot, cfg.Output.AccuracyReport)
+
+	sim.PrintCenterIntensity()
 
-	centerRe, centerIm := calculateAmplitude(edgePoints, 0, 0)
-	centerIntensity := centerRe*centerRe + centerIm*centerIm
-	fmt.Printf("Интенсивность в центре экрана: %.6f\n", centerIntensity)
+	saveMetrics(sim.Metrics(field, cfg.Output.Rings), cfg.Output.Metrics)
 
 	fmt.Printf("Полное время выполнения программы: %v\n", time.Since(start))
 
+	// При запуске с флагами или файлом конфигурации ждать нажатия не нужно
+	if !interactive {
+		return
+	}
+
 	fmt.Println("Нажмите 'q', чтобы закрыть программу")
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
@@ -86,250 +164,59 @@ func main() {
 
 }
 
-func generateDiskEdgePoints(n int, r float64) []Point {
-	points := make([]Point, n)
-	numWorkers := runtime.NumCPU()
-	chunk := (n + numWorkers - 1) / numWorkers
-
-	var wg sync.WaitGroup
-	wg.Add(numWorkers)
-
-	for w := 0; w < numWorkers; w++ {
-		start := w * chunk
-		end := start + chunk
-		if end > n {
-			end = n
-		}
-		go func(start, end int) {
-			defer wg.Done()
-			rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(start)))
-			for i := start; i < end; i++ {
-				theta := rng.Float64() * 2 * math.Pi
-				points[i] = Point{
-					X: r * math.Cos(theta),
-					Y: r * math.Sin(theta),
-				}
-			}
-		}(start, end)
-	}
-
-	wg.Wait()
-	return points
-}
-
-func calculateAmplitude(points []Point, x, y float64) (float64, float64) {
-	var re, im float64
-	k := 2 * math.Pi / lambda
-
-	// Расчет зоны Френеля
-	r0 := diskRadius                    // Радиус диска
-	b := distance                       // Расстояние до экрана
-	m := (r0 * r0 / lambda) * (1.0 / b) // Количество зон Френеля
-
-	// Если количество зон Френеля больше, делаем интенсивность в центре более темной
-	fresnelFactor := 1.0
-	if m > 1 {
-		fresnelFactor = 1 / math.Sqrt(m)
-	}
-
-	// Вычисление амплитуды
-	for _, p := range points {
-		dx := x - p.X
-		dy := y - p.Y
-		phase := (k / (2 * distance)) * (dx*dx + dy*dy) //	формула Френеля
-		re += math.Cos(phase)
-		im += math.Sin(phase) // Суммируем синусы и косинусы фаз от всех точек и получаем суммарную амплитуду в точках
-	}
-
-	n := float64(len(points))
-	amplitude := fresnelFactor * (re / n) // Средняя амплитуда на точке
-	return amplitude, fresnelFactor * (im / n)
-}
-
-func createPoissonEffectImage(points []Point, filename string) {
-	img := image.NewRGBA(image.Rect(0, 0, imgWidth, imgHeight))
-	scale := screenWidth / float64(imgWidth)
-	diskCenterX, diskCenterY := imgWidth/2, imgHeight/2
-	diskRadiusPx := int(diskRadius / scale)
-
-	// Вычисление количества зон Френеля
-	m := (diskRadius * diskRadius / lambda) * (1.0 / distance)
-	fresnelFactor := 1.0
-	if m > 1 {
-		fresnelFactor = 1 / math.Sqrt(m)
-	}
-
-	// Заполнение изображения черным цветом для пустой области
-	for y := 0; y < imgHeight; y++ {
-		for x := 0; x < imgWidth; x++ {
-			dx := x - diskCenterX
-			dy := y - diskCenterY
-			if dx*dx+dy*dy < diskRadiusPx*diskRadiusPx {
-				img.Set(x, y, color.RGBA{0, 0, 0, 255})
-				continue
-			}
-		}
-	}
-
-	// Массив интенсивности
-	intensity := make([][]float64, imgHeight)
-	for i := range intensity {
-		intensity[i] = make([]float64, imgWidth)
-	}
-
-	// Многозадачность с использованием атомарного максимума интенсивности
-	var maxIntensity uint64
-	var wg sync.WaitGroup
-	blockSize := imgHeight / 8
-	if blockSize == 0 {
-		blockSize = 1
-	}
-
-	// Создание прогрессбара
-	bar := progressbar.NewOptions(
-		imgWidth*imgHeight,
-		progressbar.OptionSetWriter(os.Stdout),
-		progressbar.OptionSetDescription("Обработка пикселей..."),
-		progressbar.OptionSetWidth(30),
-	)
-	for blockY := 0; blockY < 8 && blockY*blockSize < imgHeight; blockY++ {
-		wg.Add(1)
-		go func(blockY int) {
-			defer wg.Done()
-			startY := blockY * blockSize
-			endY := startY + blockSize
-			if endY > imgHeight {
-				endY = imgHeight
-			}
-
-			counter := 0 // Счётчик для обновления прогресс-бара
-			for y := startY; y < endY; y++ {
-				for x := 0; x < imgWidth; x++ {
-					dx := x - diskCenterX
-					dy := y - diskCenterY
-					if dx*dx+dy*dy < diskRadiusPx*diskRadiusPx {
-						continue
-					}
-					xPos := (float64(x) - float64(imgWidth)/2) * scale
-					yPos := (float64(y) - float64(imgHeight)/2) * scale
-					re, im := calculateAmplitude(points, xPos, yPos) // действительные и мнимые части амплитуды
-					intensity[y][x] = re*re + im*im
-					current := math.Float64bits(intensity[y][x])
-					for { // находим максимальную интенсивность для нормализации всех пикселей [0....1]
-						old := atomic.LoadUint64(&maxIntensity)
-						if current <= old || atomic.CompareAndSwapUint64(&maxIntensity, old, current) {
-							break
-						}
-					}
-
-					counter++
-					if counter%1000 == 0 {
-						_ = bar.Add(1000)
-					}
-				}
-			}
-		}(blockY)
-	}
-
-	wg.Wait()
-
-	// Нормализация интенсивности
-	maxI := math.Float64frombits(maxIntensity)
-	if maxI == 0 {
-		maxI = 1
+// runFarField строит картину Фраунгофера и её радиальный профиль
+func runFarField(cfg config, simCfg diffraction.Config) {
+	sim, err := diffraction.New(diffraction.WithConfig(simCfg))
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	// Отображение Пуазона с учетом интенсивности и затемнения центра
-	poissonRadius := 3
-	for y := diskCenterY - poissonRadius; y <= diskCenterY+poissonRadius; y++ {
-		for x := diskCenterX - poissonRadius; x <= diskCenterX+poissonRadius; x++ {
-			if x >= 0 && x < imgWidth && y >= 0 && y < imgHeight {
-				xPos := (float64(x) - float64(imgWidth)/2) * scale
-				yPos := (float64(y) - float64(imgHeight)/2) * scale
-				re, im := calculateAmplitude(points, xPos, yPos)
-				intens := re*re + im*im
-
-				// Уменьшаем интенсивность по центру, если много зон
-				intens *= fresnelFactor
-
-				normIntensity := intens / maxI
-				img.Set(x, y, colorFromRingIntensity(normIntensity, x, y, diskCenterX, diskCenterY))
-			}
-		}
+	field, err := sim.FarField()
+	if err != nil {
+		log.Fatal(err)
 	}
-
-	// Установка цвета пикселей с нормализованной интенсивностью
-	for y := 0; y < imgHeight; y++ {
-		for x := 0; x < imgWidth; x++ {
-			dx := x - diskCenterX
-			dy := y - diskCenterY
-			if dx*dx+dy*dy >= diskRadiusPx*diskRadiusPx {
-				normIntensity := intensity[y][x] / maxI
-				img.Set(x, y, colorFromRingIntensity(normIntensity, x, y, diskCenterX, diskCenterY))
-			}
-		}
+	saveImage(sim.FarFieldImage(field), cfg.Output.FarField)
+	savePlot(must(sim.FarFieldPlot(field)), cfg.Output.FarFieldPlot)
+	if err := sim.ExportField(field, cfg.Output.Field, cfg.Output.Export, cfg.Output.Complex); err != nil {
+		log.Fatal(err)
 	}
 
-	saveImage(img, filename)
-}
-
-func colorFromRingIntensity(intensity float64, x, y, centerX, centerY int) color.RGBA {
-	r := uint8(255 * math.Pow(intensity, 0.6))
-	g := uint8(255 * math.Pow(intensity, 0.9))
-	b := uint8(255 * math.Pow(intensity, 0.4))
-	dx := float64(x - centerX)
-	dy := float64(y - centerY)
-	dist := math.Sqrt(dx*dx + dy*dy)
-
-	// Увеличение синего цвета внутри радиуса
-	if dist < 100 {
-		b = uint8(math.Min(255, float64(b)+150*math.Pow(intensity, 0.8)))
+	// По Бабине картины препятствия и отверстия той же формы совпадают везде,
+	// кроме центра, куда собирается прошедший без дифракции пучок
+	if !sim.Shape().Opaque(2*sim.ScreenWidth+2*sim.Radius, 0) {
+		fmt.Println("Препятствие непрозрачно: по принципу Бабине картина вне центра совпадает с картиной отверстия той же формы, свет без дифракции собирается в центр")
 	}
-
-	return color.RGBA{r, g, b, 255}
+	fmt.Printf("Картина дальней зоны сохранена в %s, график — в %s\n", cfg.Output.FarField, cfg.Output.FarFieldPlot)
 }
 
-func createIntensityPlot(points []Point, filename string) {
-	p := plot.New()
-	p.Title.Text = "Распределение интенсивности"
-	p.X.Label.Text = "Расстояние от центра, мм"
-	p.Y.Label.Text = "Абсолютная интенсивность"
-
-	scale := screenWidth / float64(imgWidth)
-	pts := make(plotter.XYs, imgWidth)
-
-	var maxIntensity float64
-	for x := 0; x < imgWidth; x++ {
-		xPos := (float64(x) - float64(imgWidth)/2) * scale
-		re, im := calculateAmplitude(points, xPos, 0)
-		intensity := re*re + im*im
-		pts[x].X = xPos * 1000
-		pts[x].Y = intensity
-
-		if intensity > maxIntensity {
-			maxIntensity = intensity
-		}
+// compareWithReference сравнивает расчёт с точным решением, печатает отчёт
+// и сохраняет его вместе с графиком
+func compareWithReference(sim *diffraction.Simulation, field *diffraction.Field, plotFilename, reportFilename string) {
+	c, ok := sim.CompareWithReference(field)
+	if !ok {
+		fmt.Println("Аналитическое решение есть только для диска и круглого отверстия при плоской волне или точечном источнике и экране, перпендикулярном оси, сравнение пропущено")
+		return
 	}
 
-	if maxIntensity == 0 {
-		maxIntensity = 1
+	report, err := os.Create(reportFilename)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer report.Close()
+	c.Report(io.MultiWriter(os.Stdout, report))
+	savePlot(must(c.Plot()), plotFilename)
+}
 
-	line, err := plotter.NewLine(pts)
+// saveMetrics печатает сводку характеристик картины и сохраняет их в JSON
+func saveMetrics(m *diffraction.Metrics, filename string) {
+	m.Report(os.Stdout)
+	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
 		log.Fatal(err)
 	}
-	p.Add(line)
-	p.Add(plotter.NewGrid())
-
-	p.X.Min = -screenWidth * 1000 / 2
-	p.X.Max = screenWidth * 1000 / 2
-	p.Y.Min = 0
-	p.Y.Max = 1.1
-
-	if err := p.Save(10*vg.Centimeter, 6*vg.Centimeter, filename); err != nil {
+	if err := os.WriteFile(filename, append(data, '\n'), 0o644); err != nil {
 		log.Fatal(err)
 	}
+	fmt.Printf("Характеристики картины сохранены в %s\n", filename)
 }
 
 func saveImage(img *image.RGBA, filename string) {
@@ -344,7 +231,16 @@ func saveImage(img *image.RGBA, filename string) {
 	}
 }
 
-func calculateFresnelZones(r0, lambda, b float64) {
-	m := (r0 * r0 / lambda) * (1.0 / b)
-	fmt.Printf("Количество открытых зон Френеля: m = %.2f\n", m)
+func savePlot(p *plot.Plot, filename string) {
+	if err := p.Save(10*vg.Centimeter, 6*vg.Centimeter, filename); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// must завершает программу, если график построить не удалось
+func must(p *plot.Plot, err error) *plot.Plot {
+	if err != nil {
+		log.Fatal(err)
+	}
+	return p
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"project2/diffraction"
+)
+
+// Параметр, изменяемый от кадра к кадру
+type sweepParam struct {
+	Name string `yaml:"name" json:"name"` // wavelength, radius или distance
+	From length `yaml:"from" json:"from"`
+	To   length `yaml:"to" json:"to"`
+}
+
+// Список параметров развёртки, во флаге записывается как
+// "distance=5mm:20mm,wavelength=450nm:650nm"
+type sweepParams []sweepParam
+
+func (p sweepParams) String() string {
+	parts := make([]string, len(p))
+	for i, s := range p {
+		parts[i] = fmt.Sprintf("%s=%v:%v", s.Name, s.From, s.To)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *sweepParams) Set(v string) error {
+	var params sweepParams
+	for _, item := range strings.Split(v, ",") {
+		name, rng, ok := strings.Cut(strings.TrimSpace(item), "=")
+		from, to, ok2 := strings.Cut(rng, ":")
+		if !ok || !ok2 {
+			return fmt.Errorf("неверный параметр развёртки %q (ожидается имя=от:до)", item)
+		}
+		s := sweepParam{Name: strings.TrimSpace(name)}
+		var err error
+		if s.From, err = parseLength(from); err != nil {
+			return err
+		}
+		if s.To, err = parseLength(to); err != nil {
+			return err
+		}
+		params = append(params, s)
+	}
+	*p = params
+	return nil
+}
+
+// Настройки развёртки по параметрам
+type sweepConfig struct {
+	Params sweepParams `yaml:"params" json:"params"`
+	Frames int         `yaml:"frames" json:"frames"`
+	Delay  int         `yaml:"delay" json:"delay"` // пауза между кадрами, сотые доли секунды
+	GIF    string      `yaml:"gif" json:"gif"`
+	CSV    string      `yaml:"csv" json:"csv"`
+}
+
+func (s sweepConfig) validate() error {
+	if len(s.Params) == 0 {
+		return nil
+	}
+	if s.Frames < 2 {
+		return fmt.Errorf("для развёртки нужно не меньше 2 кадров, получено %d", s.Frames)
+	}
+	for _, p := range s.Params {
+		switch p.Name {
+		case "wavelength", "radius", "distance":
+		default:
+			return fmt.Errorf("неизвестный параметр развёртки %q (ожидается wavelength, radius или distance)", p.Name)
+		}
+		if p.From <= 0 || p.To <= 0 {
+			return fmt.Errorf("границы развёртки %s должны быть положительными", p.Name)
+		}
+	}
+	return nil
+}
+
+// Результат одного кадра развёртки
+type sweepFrame struct {
+	lambda, radius, distance float64
+	centerIntensity          float64
+	fresnelZones             float64
+	sim                      *diffraction.Simulation
+	field                    *diffraction.Field
+}
+
+// runSweep рассчитывает кадры, линейно меняя параметры, нормирует все кадры
+// на общий максимум, чтобы яркость была сравнима, и сохраняет анимацию и CSV.
+// При прерывании сохраняются уже готовые кадры.
+func runSweep(ctx context.Context, cfg config) {
+	sweep := cfg.Sweep
+	frames := make([]sweepFrame, sweep.Frames)
+
+	// Контрольные точки и распределённый расчёт к развёртке не относятся
+	simCfg := cfg.simulationConfig()
+	simCfg.Checkpoint, simCfg.Remotes = "", nil
+
+	var maxI float64
+	for i := range frames {
+		t := float64(i) / float64(sweep.Frames-1)
+		for _, p := range sweep.Params {
+			v := float64(p.From) + t*float64(p.To-p.From)
+			switch p.Name {
+			case "wavelength":
+				simCfg.Wavelength = v
+			case "radius":
+				simCfg.Radius = v
+			case "distance":
+				simCfg.Distance = v
+			}
+		}
+
+		fmt.Printf("Кадр %d/%d: λ = %.4g м, радиус = %.4g м, расстояние = %.4g м\n", i+1, sweep.Frames, simCfg.Wavelength, simCfg.Radius, simCfg.Distance)
+		sim, err := diffraction.New(diffraction.WithConfig(simCfg))
+		if err != nil {
+			log.Fatal(err)
+		}
+		simCfg.Seed = sim.Seed // все кадры используют одну и ту же выборку края
+
+		field := sim.Field(ctx)
+		if field.Partial {
+			fmt.Printf("Развёртка прервана на кадре %d\n", i+1)
+			frames = frames[:i]
+			break
+		}
+		field.StdErr, field.Re, field.Im = nil, nil, nil // для анимации нужна только интенсивность
+
+		m := simCfg.FresnelZones()
+		fmt.Printf("Количество открытых зон Френеля: m = %.2f\n", m)
+		frames[i] = sweepFrame{
+			lambda:          simCfg.Wavelength,
+			radius:          simCfg.Radius,
+			distance:        simCfg.Distance,
+			centerIntensity: sim.Intensity(0, 0),
+			fresnelZones:    m,
+			sim:             sim,
+			field:           field,
+		}
+		maxI = math.Max(maxI, field.MaxIntensity)
+	}
+
+	if len(frames) == 0 {
+		return
+	}
+
+	anim := &gif.GIF{}
+	for _, f := range frames {
+		img := f.sim.RenderImage(f.field, f.sim.DisplayMax(maxI))
+		paletted := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, image.Point{})
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, sweep.Delay)
+	}
+	saveGIF(anim, sweep.GIF)
+	saveSweepCSV(frames, sweep.CSV)
+	fmt.Printf("Анимация сохранена в %s, таблица кадров в %s\n", sweep.GIF, sweep.CSV)
+}
+
+func saveGIF(anim *gif.GIF, filename string) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := gif.EncodeAll(f, anim); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func saveSweepCSV(frames []sweepFrame, filename string) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"frame", "wavelength_m", "radius_m", "distance_m", "center_intensity", "fresnel_zones"})
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', 8, 64) }
+	for i, fr := range frames {
+		w.Write([]string{
+			strconv.Itoa(i),
+			format(fr.lambda),
+			format(fr.radius),
+			format(fr.distance),
+			format(fr.centerIntensity),
+			format(fr.fresnelZones),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatal(err)
+	}
+}
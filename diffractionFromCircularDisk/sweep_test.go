@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSweepParamsSet(t *testing.T) {
+	cases := []struct {
+		in   string
+		want sweepParams
+	}{
+		{"distance=5mm:20mm", sweepParams{{"distance", 5e-3, 20e-3}}},
+		{"distance=5mm:20mm,wavelength=450nm:650nm", sweepParams{{"distance", 5e-3, 20e-3}, {"wavelength", 450e-9, 650e-9}}},
+		{" radius = 50um:0.2mm", sweepParams{{"radius", 50e-6, 0.2e-3}}},
+		{"radius=0.1:0.05", sweepParams{{"radius", 0.1, 0.05}}},
+	}
+	for _, tc := range cases {
+		var p sweepParams
+		if err := p.Set(tc.in); err != nil {
+			t.Errorf("Set(%q): неожиданная ошибка %v", tc.in, err)
+			continue
+		}
+		same := len(p) == len(tc.want)
+		for i := 0; same && i < len(p); i++ {
+			same = p[i].Name == tc.want[i].Name && closeLength(p[i].From, tc.want[i].From) && closeLength(p[i].To, tc.want[i].To)
+		}
+		if !same {
+			t.Errorf("Set(%q) = %v, ожидается %v", tc.in, p, tc.want)
+		}
+	}
+
+	errs := []struct {
+		in   string
+		want string
+	}{
+		{"distance", "имя=от:до"},
+		{"distance=5mm", "имя=от:до"},
+		{"distance=5mm:20mm,", "имя=от:до"},
+		{"distance=5mm:20xx", "неверная длина"},
+		{"distance=:20mm", "неверная длина"},
+	}
+	for _, tc := range errs {
+		var p sweepParams
+		err := p.Set(tc.in)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Set(%q): ошибка %v, ожидается ошибка с %q", tc.in, err, tc.want)
+		}
+	}
+}
+
+func TestSweepConfigValidate(t *testing.T) {
+	params := sweepParams{{"distance", 5e-3, 20e-3}}
+	cases := []struct {
+		name string
+		cfg  sweepConfig
+		want string // пусто — настройки верны
+	}{
+		{"без развёртки", sweepConfig{}, ""},
+		{"верные настройки", sweepConfig{Params: params, Frames: 10}, ""},
+		{"один кадр", sweepConfig{Params: params, Frames: 1}, "2 кадров"},
+		{"неизвестный параметр", sweepConfig{Params: sweepParams{{"screen", 1e-3, 2e-3}}, Frames: 10}, "screen"},
+		{"нулевая граница", sweepConfig{Params: sweepParams{{"radius", 0, 2e-3}}, Frames: 10}, "положительными"},
+	}
+	for _, tc := range cases {
+		err := tc.cfg.validate()
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: неожиданная ошибка %v", tc.name, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Errorf("%s: ошибка %v, ожидается ошибка с %q", tc.name, err, tc.want)
+		}
+	}
+}